@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// archiveEntry is a file on disk to be copied into the archive under name.
+type archiveEntry struct {
+	path string
+	name string
+}
+
+// tarArchive writes a gzip-compressed tar stream. Workers run concurrently but a
+// tar stream must be written sequentially, so entries are queued on a channel and
+// written by a single goroutine that streams each file from disk.
+type tarArchive struct {
+	entries chan archiveEntry
+	done    chan error
+}
+
+// newTarArchive creates the archive file at path and starts its writer goroutine.
+func newTarArchive(path string, mode os.FileMode) (*tarArchive, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(mode); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	a := &tarArchive{
+		entries: make(chan archiveEntry, 64),
+		done:    make(chan error, 1),
+	}
+	go a.run(file)
+	return a, nil
+}
+
+// add queues a file to be written to the archive under name.
+func (a *tarArchive) add(path, name string) {
+	a.entries <- archiveEntry{path: path, name: filepath.ToSlash(name)}
+}
+
+// close flushes all queued entries and finalizes the archive.
+func (a *tarArchive) close() error {
+	close(a.entries)
+	return <-a.done
+}
+
+// run writes queued entries until the channel is closed. A failed entry is logged
+// and skipped so that one unreadable file does not truncate the archive.
+func (a *tarArchive) run(file *os.File) {
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	for entry := range a.entries {
+		if err := writeTarEntry(tw, entry); err != nil {
+			log.Printf("Error adding %s to archive: %v", entry.name, err)
+		}
+	}
+
+	a.done <- errors.Join(tw.Close(), gz.Close(), file.Close())
+}
+
+// writeTarEntry streams a single file from disk into the tar writer.
+func writeTarEntry(tw *tar.Writer, entry archiveEntry) error {
+	in, err := os.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			log.Printf("Error closing file %s: %v", entry.path, err)
+		}
+	}()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = entry.name
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// archiveRecord queues the metadata and the locally present attachments of a
+// processed record for archiving, reading them from their respective trees.
+func archiveRecord(archive *tarArchive, metadataDir, attachmentsDir string, result RecordResult) {
+	metadataName := filepath.Join(result.recordDir(), "metadata.json")
+	if _, err := os.Stat(filepath.Join(metadataDir, metadataName)); err == nil {
+		archive.add(filepath.Join(metadataDir, metadataName), metadataName)
+	}
+	for _, attachment := range result.Attachments {
+		if attachment.Status == attachmentFailed || attachment.Status == attachmentMissing {
+			continue
+		}
+		archive.add(filepath.Join(attachmentsDir, filepath.FromSlash(attachment.Path)), attachment.Path)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLog returns the output logged until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// recordWithMissing writes record 1 to dir with one downloaded attachment, and
+// returns its result, which also lists a failed and a missing attachment.
+func recordWithMissing(t *testing.T, dir string) RecordResult {
+	t.Helper()
+	result := RecordResult{ID: 1, Attachments: []AttachmentResult{
+		{Name: "a.txt", Path: "record_1/a.txt", Status: attachmentDownloaded},
+		{Name: "b.txt", Path: "record_1/b.txt", Status: attachmentFailed},
+		{Name: "c.txt", Path: "record_1/c.txt", Status: attachmentMissing},
+	}}
+	recordDir := filepath.Join(dir, result.recordDir())
+	if err := os.MkdirAll(recordDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"metadata.json": `{"id": 1}`, "a.txt": "content"} {
+		if err := os.WriteFile(filepath.Join(recordDir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return result
+}
+
+func TestArchiveRecordSkipsAbsentAttachments(t *testing.T) {
+	dir := t.TempDir()
+	result := recordWithMissing(t, dir)
+	logged := captureLog(t)
+
+	path := filepath.Join(t.TempDir(), "export.tar.gz")
+	archive, err := newTarArchive(path, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveRecord(archive, dir, dir, result)
+	if err := archive.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for tr := tar.NewReader(gz); ; {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if got, want := strings.Join(names, " "), "record_1/metadata.json record_1/a.txt"; got != want {
+		t.Errorf("archive entries = %s, want %s", got, want)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("logged %q, want nothing", logged)
+	}
+}
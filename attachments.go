@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Naming schemes for attachments saved with -flatten.
+const (
+	flattenPrefixed = "prefixed" // <id>__<name>
+	flattenOriginal = "original" // <name>
+)
+
+// groupByExt groups attachments into subdirectories named after their extension.
+const groupByExt = "ext"
+
+// otherGroup is the subdirectory for attachments without a usable extension.
+const otherGroup = "other"
+
+// attachmentGroup returns the subdirectory for an attachment grouped by extension:
+// the lower-cased extension stripped of anything but letters and digits, or
+// otherGroup if nothing is left.
+func attachmentGroup(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	group := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, ext)
+	if group == "" {
+		return otherGroup
+	}
+	return group
+}
+
+// latestAttachments keeps only the most recently uploaded version of each
+// attachment name, preserving the API order of the survivors. It returns the
+// retained attachments and the number of older versions that were dropped.
+func latestAttachments(files []File) ([]File, int) {
+	latest := make(map[string]File, len(files))
+	for _, file := range files {
+		current, ok := latest[file.Name]
+		if !ok || uploadedAfter(file, current) {
+			latest[file.Name] = file
+		}
+	}
+
+	kept := make([]File, 0, len(latest))
+	for _, file := range files {
+		if latest[file.Name] == file {
+			kept = append(kept, file)
+			delete(latest, file.Name) // Guard against identical duplicates.
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+// newestAttachments keeps the n most recently uploaded attachments, newest
+// first. It returns the retained attachments and the number that were dropped.
+func newestAttachments(files []File, n int) ([]File, int) {
+	if len(files) <= n {
+		return files, 0
+	}
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b File) int {
+		switch {
+		case uploadedAfter(a, b):
+			return -1
+		case uploadedAfter(b, a):
+			return 1
+		}
+		return 0
+	})
+	return sorted[:n], len(files) - n
+}
+
+// uploadedAfter reports whether a was uploaded after b. Timestamps are compared
+// as RFC 3339 times, falling back to a string comparison if either fails to parse.
+func uploadedAfter(a, b File) bool {
+	ta, errA := time.Parse(time.RFC3339, a.UploadedAt)
+	tb, errB := time.Parse(time.RFC3339, b.UploadedAt)
+	if errA != nil || errB != nil {
+		return a.UploadedAt > b.UploadedAt
+	}
+	return ta.After(tb)
+}
+
+// nameRegistry tracks the file names claimed in a shared directory so that
+// concurrent workers never write two attachments to the same path.
+type nameRegistry struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// newNameRegistry creates an empty name registry.
+func newNameRegistry() *nameRegistry {
+	return &nameRegistry{names: make(map[string]bool)}
+}
+
+// claim reserves name, reporting false if it was already taken.
+func (r *nameRegistry) claim(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		return false
+	}
+	r.names[name] = true
+	return true
+}
+
+// flatName returns the name under which an attachment is saved in the flat output
+// directory, following the configured naming scheme. If that name was already
+// claimed by another attachment, the document ID is added to make it unique and
+// collided is set so the caller can report it. Should that name be taken too, as
+// by the same document listed twice, a counter is added before the extension
+// (12__34__report_2.pdf) and the residual collision is logged.
+func flatName(opts *options, requestID int, attachment File) (name string, collided bool) {
+	name = attachment.Name
+	if opts.flattenNaming == flattenPrefixed {
+		name = fmt.Sprintf("%d__%s", requestID, attachment.Name)
+	}
+	if opts.flatNames.claim(name) {
+		return name, false
+	}
+
+	name = fmt.Sprintf("%d__%d__%s", requestID, attachment.DocumentID, attachment.Name)
+	if opts.flatNames.claim(name) {
+		return name, true
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		if candidate := fmt.Sprintf("%s_%d%s", base, n, ext); opts.flatNames.claim(candidate) {
+			log.Printf("Warning: flat name %s of record %d is taken even with its document ID; using %s", name, requestID, candidate)
+			return candidate, true
+		}
+	}
+}
+
+// recordName returns the name under which an attachment is saved in its record
+// directory. The first attachment keeps its name; later attachments with the
+// same name get their document ID, and if needed a counter, appended before
+// the extension (report_123.pdf, report_123_2.pdf), and collided is set so the
+// caller can report it.
+func recordName(names *nameRegistry, attachment File) (name string, collided bool) {
+	if names.claim(attachment.Name) {
+		return attachment.Name, false
+	}
+
+	ext := filepath.Ext(attachment.Name)
+	base := strings.TrimSuffix(attachment.Name, ext)
+	name = fmt.Sprintf("%s_%d%s", base, attachment.DocumentID, ext)
+	for n := 2; !names.claim(name); n++ {
+		name = fmt.Sprintf("%s_%d_%d%s", base, attachment.DocumentID, n, ext)
+	}
+	return name, true
+}
+
+// watermarkTolerance is how far before a record's watermark an attachment may
+// have been uploaded and still count as new, to allow for clock skew between
+// the API servers. Files saved by an earlier run are then skipped as existing.
+const watermarkTolerance = 5 * time.Minute
+
+// attachmentsSince keeps the attachments uploaded after watermark, less the
+// tolerance. Attachments without a parseable upload time are kept. It returns
+// the retained attachments and the number of older ones that were dropped.
+func attachmentsSince(files []File, watermark time.Time) ([]File, int) {
+	cutoff := watermark.Add(-watermarkTolerance)
+	kept := make([]File, 0, len(files))
+	for _, file := range files {
+		uploaded, err := time.Parse(time.RFC3339, file.UploadedAt)
+		if err != nil || uploaded.After(cutoff) {
+			kept = append(kept, file)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+// latestUpload returns the upload time of the most recently uploaded attachment,
+// or "" if there are none.
+func latestUpload(files []File) string {
+	var latest File
+	for _, file := range files {
+		if latest.UploadedAt == "" || uploadedAfter(file, latest) {
+			latest = file
+		}
+	}
+	return latest.UploadedAt
+}
+
+// parseDocumentIDs parses the document IDs given to -document-id-include or
+// -document-id-exclude into a set.
+func parseDocumentIDs(values []string) (map[int]bool, error) {
+	ids := make(map[int]bool, len(values))
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid document ID %q", value)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// filterDocuments keeps the attachments whose document ID is in include, if
+// any IDs are given, and not in exclude. It returns the retained attachments,
+// the number of them matched by include, and the number dropped.
+func filterDocuments(files []File, include, exclude map[int]bool) (kept []File, included, excluded int) {
+	kept = make([]File, 0, len(files))
+	for _, file := range files {
+		if exclude[file.DocumentID] || (len(include) > 0 && !include[file.DocumentID]) {
+			excluded++
+			continue
+		}
+		if include[file.DocumentID] {
+			included++
+		}
+		kept = append(kept, file)
+	}
+	return kept, included, excluded
+}
+
+// Policies of -undated-attachments for attachments whose upload time cannot be
+// parsed when filtering with -attachments-since.
+const (
+	undatedDownload = "download"
+	undatedSkip     = "skip"
+)
+
+// parseSinceDate parses the -attachments-since date, given either as a date
+// (YYYY-MM-DD), which starts at midnight UTC, or as an RFC 3339 timestamp.
+func parseSinceDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+// attachmentsUploadedSince keeps the attachments uploaded at or after since.
+// Attachments without a parseable upload time are kept unless skipUndated is
+// set. It returns the retained attachments and the number that were dropped.
+func attachmentsUploadedSince(files []File, since time.Time, skipUndated bool) ([]File, int) {
+	kept := make([]File, 0, len(files))
+	for _, file := range files {
+		uploaded, err := time.Parse(time.RFC3339, file.UploadedAt)
+		if err != nil {
+			if !skipUndated {
+				kept = append(kept, file)
+			}
+			continue
+		}
+		if !uploaded.Before(since) {
+			kept = append(kept, file)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFlatNameCollisions(t *testing.T) {
+	type flatFile struct {
+		requestID int
+		file      File
+	}
+	tests := []struct {
+		name         string
+		naming       string
+		files        []flatFile
+		want         []string
+		wantCollided []bool
+	}{
+		{
+			name:   "prefixed names across records",
+			naming: flattenPrefixed,
+			files: []flatFile{
+				{1, File{DocumentID: 10, Name: "report.pdf"}},
+				{2, File{DocumentID: 20, Name: "report.pdf"}},
+				{1, File{DocumentID: 11, Name: "report.pdf"}},
+			},
+			want:         []string{"1__report.pdf", "2__report.pdf", "1__11__report.pdf"},
+			wantCollided: []bool{false, false, true},
+		},
+		{
+			name:   "original names across records",
+			naming: flattenOriginal,
+			files: []flatFile{
+				{1, File{DocumentID: 10, Name: "report.pdf"}},
+				{2, File{DocumentID: 20, Name: "report.pdf"}},
+				{3, File{DocumentID: 30, Name: "report.pdf"}},
+			},
+			want:         []string{"report.pdf", "2__20__report.pdf", "3__30__report.pdf"},
+			wantCollided: []bool{false, true, true},
+		},
+		{
+			name:   "residual collision of the same document",
+			naming: flattenOriginal,
+			files: []flatFile{
+				{1, File{DocumentID: 10, Name: "report.pdf"}},
+				{2, File{DocumentID: 20, Name: "report.pdf"}},
+				{2, File{DocumentID: 20, Name: "report.pdf"}},
+				{2, File{DocumentID: 20, Name: "report.pdf"}},
+			},
+			want:         []string{"report.pdf", "2__20__report.pdf", "2__20__report_2.pdf", "2__20__report_3.pdf"},
+			wantCollided: []bool{false, true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &options{flattenNaming: tt.naming, flatNames: newNameRegistry()}
+			for i, f := range tt.files {
+				got, collided := flatName(opts, f.requestID, f.file)
+				if got != tt.want[i] || collided != tt.wantCollided[i] {
+					t.Errorf("flatName(%d, %s) = %q, %t; want %q, %t", f.requestID, f.file.Name, got, collided, tt.want[i], tt.wantCollided[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordNameDuplicates(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/attachments") {
+			_, _ = w.Write([]byte(`{"data": {"files": [
+				{"document_id": 10, "name": "report.pdf"},
+				{"document_id": 11, "name": "report.pdf"},
+				{"document_id": 12, "name": "notes.txt"},
+				{"document_id": 11, "name": "report.pdf"},
+				{"document_id": 13, "name": "report_11.pdf"}
+			]}}`))
+			return
+		}
+		fmt.Fprintf(w, "content of %s", r.URL.Path)
+	}))
+	ctx := context.Background()
+	attachments, err := client.GetAttachments(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetAttachments: %v", err)
+	}
+
+	want := []struct {
+		name     string
+		collided bool
+	}{
+		{"report.pdf", false},
+		{"report_11.pdf", true},
+		{"notes.txt", false},
+		{"report_11_2.pdf", true},
+		{"report_11_13.pdf", true}, // Its name was given to the second report.pdf.
+	}
+
+	dir := t.TempDir()
+	names := newNameRegistry()
+	for i, attachment := range attachments {
+		target := attachment
+		var collided bool
+		target.Name, collided = recordName(names, attachment)
+		if target.Name != want[i].name || collided != want[i].collided {
+			t.Errorf("recordName(%s) = %q, %t; want %q, %t", attachment.Name, target.Name, collided, want[i].name, want[i].collided)
+		}
+		if err := client.DownloadAttachment(ctx, 1, target, dir, false); err != nil {
+			t.Errorf("DownloadAttachment(%s): %v", target.Name, err)
+		}
+	}
+
+	// Every attachment is saved; none overwrites another.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(attachments) {
+		t.Errorf("saved %d files, want %d", len(entries), len(attachments))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "/files/10") {
+		t.Errorf("report.pdf = %q, want the first document", data)
+	}
+}
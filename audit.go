@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// auditFileName is the name of the report written by -audit-local in the audited directory.
+const auditFileName = "audit.json"
+
+// AuditRecord is the reconciliation of a local record directory with the
+// attachments the API currently lists for the record. Orphans are local files
+// that no longer exist remotely, and Gaps are remote attachments missing
+// locally, both relative to the record directory.
+type AuditRecord struct {
+	ID      int      `json:"id"`
+	Dir     string   `json:"dir"`
+	Deleted bool     `json:"deleted,omitempty"`
+	Orphans []string `json:"orphans,omitempty"`
+	Gaps    []string `json:"gaps,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// AuditReport is the report written by -audit-local.
+type AuditReport struct {
+	Dir     string        `json:"dir"`
+	Records []AuditRecord `json:"records"`
+	Orphans int           `json:"orphans"`
+	Gaps    int           `json:"gaps"`
+	Failed  int           `json:"failed"`
+}
+
+// findRecordDirs returns the record directories of an output directory, both
+// record_<id> at its root and under a status directory of -group-by status,
+// keyed by the relative directory. A record found in several places is
+// audited in each.
+func findRecordDirs(dir string) (map[string]int, error) {
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	dirs := make(map[string]int)
+	for _, pattern := range []string{"record_*", filepath.Join("*", "record_*")} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(match), "record_"))
+			if err != nil || recordDirName(id) != filepath.Base(match) {
+				continue
+			}
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			dirs[rel] = id
+		}
+	}
+	return dirs, nil
+}
+
+// localAttachments returns the attachments saved in a record directory by file
+// name, mapped to their path relative to it, which includes the subdirectory
+// of -group-attachments. The metadata and hidden files, such as the temporary
+// files of interrupted downloads, and the files of -fetch-inline are not
+// attachments.
+func localAttachments(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || (d.IsDir() && d.Name() == inlineDirName) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name() == "metadata.json" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[d.Name()] = filepath.ToSlash(rel)
+		return nil
+	})
+	return files, err
+}
+
+// auditRecord compares the attachments saved in a record directory with those
+// the API lists for the record, named as a download would name them. A record
+// that no longer exists remotely has all its files reported as orphans.
+func auditRecord(ctx context.Context, client *Client, dir string, record *AuditRecord) error {
+	local, err := localAttachments(dir)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	remote, err := client.GetAttachmentsFor(ctx, &Request{ID: record.ID})
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		record.Deleted = true
+		remote = nil
+	case err != nil:
+		return fmt.Errorf("error getting attachments for record %d: %w", record.ID, err)
+	}
+
+	names := newNameRegistry()
+	for _, attachment := range remote {
+		name, _ := recordName(names, attachment)
+		if _, ok := local[name]; ok {
+			delete(local, name)
+			continue
+		}
+		if _, ok := local[name+compressedExt]; ok {
+			delete(local, name+compressedExt) // Stored by -compress.
+			continue
+		}
+		record.Gaps = append(record.Gaps, name)
+	}
+	for _, path := range local {
+		record.Orphans = append(record.Orphans, path)
+	}
+	sort.Strings(record.Orphans)
+	return nil
+}
+
+// buildAudit audits every record directory of dir using up to workers
+// concurrent API calls. A record that cannot be audited is logged and counted
+// as failed.
+func buildAudit(ctx context.Context, client *Client, dir string, workers int) (AuditReport, error) {
+	dirs, err := findRecordDirs(dir)
+	if err != nil {
+		return AuditReport{}, err
+	}
+
+	report := AuditReport{Dir: dir}
+	for rel, id := range dirs {
+		report.Records = append(report.Records, AuditRecord{ID: id, Dir: filepath.ToSlash(rel)})
+	}
+	slices.SortFunc(report.Records, func(a, b AuditRecord) int {
+		if a.ID != b.ID {
+			return a.ID - b.ID
+		}
+		return strings.Compare(a.Dir, b.Dir)
+	})
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range report.Records {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(record *AuditRecord) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := auditRecord(ctx, client, filepath.Join(dir, record.Dir), record); err != nil {
+				log.Printf("Error auditing record %d: %v", record.ID, err)
+				record.Error = err.Error()
+			}
+		}(&report.Records[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	for _, record := range report.Records {
+		report.Orphans += len(record.Orphans)
+		report.Gaps += len(record.Gaps)
+		if record.Error != "" {
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// runAudit reconciles the local copy in dir with the current API state without
+// downloading anything, prints the orphans and gaps of each record, and writes
+// the report to dir. Any orphan, gap, or record that could not be audited makes
+// it return an error once the report is written.
+func runAudit(ctx context.Context, client *Client, dir string, workers int, opts *options) error {
+	report, err := buildAudit(ctx, client, dir, workers)
+	if err != nil {
+		return fmt.Errorf("failed to audit %s: %w", dir, err)
+	}
+
+	for _, record := range report.Records {
+		if record.Deleted {
+			console.Printf("Record %d (%s) no longer exists remotely\n", record.ID, record.Dir)
+		}
+		for _, path := range record.Orphans {
+			console.Printf("Orphan: %s/%s\n", record.Dir, path)
+		}
+		for _, name := range record.Gaps {
+			console.Printf("Missing: %s/%s\n", record.Dir, name)
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, auditFileName)
+	if err := writeFileAtomic(path, data, opts.fileMode); err != nil {
+		return fmt.Errorf("failed to write audit report: %w", err)
+	}
+	console.Printf("Audited %d records: %d orphans, %d missing, %d failed. Report written to %s\n",
+		len(report.Records), report.Orphans, report.Gaps, report.Failed, path)
+
+	if report.Orphans > 0 || report.Gaps > 0 || report.Failed > 0 {
+		return errors.New("the local copy is out of sync with the API")
+	}
+	return nil
+}
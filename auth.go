@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errInvalidToken reports a token without the key_id:key_secret form of ZenGRC
+// API tokens. The token itself is never included, since it is a credential.
+var errInvalidToken = errors.New("the token must have the form key_id:key_secret")
+
+// TokenProvider returns a fresh bearer access token.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// WithTokenProvider authenticates with short-lived bearer tokens instead of
+// Basic authentication. The token passed to NewClient, if any, is used first;
+// otherwise the provider is asked for one on the first request. When a request
+// is rejected with 401, the provider is called for a new token and the request
+// is retried once.
+func WithTokenProvider(provider TokenProvider) Option {
+	return func(c *Client) {
+		c.tokenProvider = provider
+	}
+}
+
+// bearerAuth caches the current bearer token of a client using a token provider.
+type bearerAuth struct {
+	mu    sync.Mutex
+	token string
+}
+
+// authorization returns the Authorization header value for a new request.
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	if c.tokenProvider == nil {
+		if err := checkToken(c.token); err != nil {
+			return "", err
+		}
+		return basicAuth(c.token), nil
+	}
+
+	c.bearer.mu.Lock()
+	defer c.bearer.mu.Unlock()
+	if c.bearer.token == "" {
+		token, err := c.tokenProvider(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to obtain an access token: %w", err)
+		}
+		c.bearer.token = token
+	}
+	return "Bearer " + c.bearer.token, nil
+}
+
+// refreshAuthorization replaces the bearer token that req was sent with and
+// updates req to use the new one. If another request already refreshed it in
+// the meantime, the newer token is reused rather than asking the provider again.
+func (c *Client) refreshAuthorization(req *http.Request) error {
+	c.bearer.mu.Lock()
+	defer c.bearer.mu.Unlock()
+
+	if req.Header.Get("Authorization") == "Bearer "+c.bearer.token {
+		token, err := c.tokenProvider(req.Context())
+		if err != nil {
+			return fmt.Errorf("failed to refresh the access token: %w", err)
+		}
+		c.bearer.token = token
+		log.Printf("Access token refreshed after a 401 response")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.bearer.token)
+	return nil
+}
+
+// checkToken verifies that token has the key_id:key_secret form expected for
+// Basic authentication, with a non-empty key ID and secret.
+func checkToken(token string) error {
+	keyID, secret, ok := strings.Cut(token, ":")
+	switch {
+	case !ok:
+		return fmt.Errorf("%w, but it has no colon", errInvalidToken)
+	case keyID == "":
+		return fmt.Errorf("%w, but the key ID is empty", errInvalidToken)
+	case secret == "":
+		return fmt.Errorf("%w, but the secret is empty", errInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// jsonBundle writes a single JSON document holding the metadata of every
+// processed record and its attachments, base64-encoded inline. Like the tar
+// archive, records are queued on a channel and written by a single goroutine
+// that streams each file from disk, so attachments are never held in memory.
+//
+// The document has the form:
+//
+//	{"version": "...", "generated_at": "...", "records": [
+//	  {"id": 1, "metadata": {...}, "attachments": [
+//	    {"document_id": 10, "name": "a.pdf", "path": "record_1/a.pdf", "content_base64": "..."}]}]}
+type jsonBundle struct {
+	metadataDir    string
+	attachmentsDir string
+	records        chan RecordResult
+	done           chan error
+}
+
+// bundleAttachment is the header of an attachment in the bundle; its content is
+// streamed separately.
+type bundleAttachment struct {
+	DocumentID int    `json:"document_id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+}
+
+// newJSONBundle creates the bundle file at path and starts its writer goroutine.
+// Metadata and attachments are read from their respective trees.
+func newJSONBundle(path, metadataDir, attachmentsDir string, mode os.FileMode) (*jsonBundle, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(mode); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	b := &jsonBundle{
+		metadataDir:    metadataDir,
+		attachmentsDir: attachmentsDir,
+		records:        make(chan RecordResult, 64),
+		done:           make(chan error, 1),
+	}
+	go b.run(file)
+	return b, nil
+}
+
+// add queues a processed record to be written to the bundle.
+func (b *jsonBundle) add(result RecordResult) {
+	b.records <- result
+}
+
+// close writes all queued records and terminates the document.
+func (b *jsonBundle) close() error {
+	close(b.records)
+	return <-b.done
+}
+
+// run writes queued records until the channel is closed. Write errors are sticky
+// in the buffered writer and reported when the bundle is closed.
+func (b *jsonBundle) run(file *os.File) {
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "{\"version\": %s, \"generated_at\": %s, \"records\": [",
+		jsonString(appVersion()), jsonString(time.Now().UTC().Format(time.RFC3339)))
+
+	first := true
+	for result := range b.records {
+		if !first {
+			_, _ = w.WriteString(",")
+		}
+		first = false
+		b.writeRecord(w, result)
+	}
+
+	_, _ = w.WriteString("\n]}\n")
+	b.done <- errors.Join(w.Flush(), file.Close())
+}
+
+// writeRecord writes one record with its metadata and its locally present
+// attachments. A file that cannot be read is logged and left out, or, if it
+// fails midway, ends with an "error" member, so the document always stays valid.
+func (b *jsonBundle) writeRecord(w *bufio.Writer, result RecordResult) {
+	metadataPath := filepath.Join(b.metadataDir, result.recordDir(), "metadata.json")
+	metadata, err := os.ReadFile(metadataPath)
+	if err != nil || !json.Valid(metadata) {
+		log.Printf("Error adding metadata of record %d to bundle: %v", result.ID, err)
+		metadata = []byte("null")
+	}
+	fmt.Fprintf(w, "\n{\"id\": %d, \"metadata\": ", result.ID)
+	_, _ = w.Write(metadata)
+	_, _ = w.WriteString(", \"attachments\": [")
+
+	first := true
+	for _, attachment := range result.Attachments {
+		if attachment.Status == attachmentFailed || attachment.Status == attachmentMissing {
+			continue
+		}
+		in, err := os.Open(filepath.Join(b.attachmentsDir, filepath.FromSlash(attachment.Path)))
+		if err != nil {
+			log.Printf("Error adding %s to bundle: %v", attachment.Path, err)
+			continue
+		}
+		if !first {
+			_, _ = w.WriteString(",")
+		}
+		first = false
+
+		header, _ := json.Marshal(bundleAttachment{DocumentID: attachment.DocumentID, Name: attachment.Name, Path: attachment.Path})
+		_, _ = w.Write(header[:len(header)-1]) // Leave the object open for the content.
+		_, _ = w.WriteString(", \"content_base64\": \"")
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		_, copyErr := io.Copy(enc, in)
+		_ = enc.Close()
+		_ = in.Close()
+		_, _ = w.WriteString("\"")
+		if copyErr != nil {
+			log.Printf("Error adding %s to bundle: %v", attachment.Path, copyErr)
+			fmt.Fprintf(w, ", \"error\": %s", jsonString(copyErr.Error()))
+		}
+		_, _ = w.WriteString("}")
+	}
+	_, _ = w.WriteString("]}")
+}
+
+// jsonString encodes s as a JSON string.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleSkipsAbsentAttachments(t *testing.T) {
+	dir := t.TempDir()
+	result := recordWithMissing(t, dir)
+	logged := captureLog(t)
+
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	bundle, err := newJSONBundle(path, dir, dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.add(result)
+	if err := bundle.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Records []struct {
+			Attachments []bundleAttachment `json:"attachments"`
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("bundle is not valid JSON: %v", err)
+	}
+	if len(doc.Records) != 1 || len(doc.Records[0].Attachments) != 1 || doc.Records[0].Attachments[0].Name != "a.txt" {
+		t.Errorf("bundle records = %+v, want record 1 with a.txt only", doc.Records)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("logged %q, want nothing", logged)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Default bounds of the request details cache enabled by the command line.
+const (
+	defaultDetailsCacheSize = 1000
+	defaultDetailsCacheTTL  = 10 * time.Minute
+)
+
+// WithDetailsCache caches up to size request details for ttl, so that
+// GetRequestDetails does not call the API again for a request it has just
+// fetched, such as a duplicated ID in an IDs file.
+func WithDetailsCache(size int, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.detailsCache = newDetailsCache(size, ttl)
+	}
+}
+
+// ClearDetailsCache drops every cached request, so that the next calls fetch
+// fresh details.
+func (c *Client) ClearDetailsCache() {
+	c.detailsCache.clear()
+}
+
+// detailsCache is a concurrency-safe, least recently used cache of request
+// details whose entries expire after a TTL. A nil cache caches nothing.
+type detailsCache struct {
+	size  int
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	order   *list.List // Most recently used first.
+	entries map[int]*list.Element
+}
+
+// cachedRequest is an entry of the details cache.
+type cachedRequest struct {
+	request Request
+	expires time.Time
+}
+
+// newDetailsCache creates an empty cache holding up to size entries for ttl.
+func newDetailsCache(size int, ttl time.Duration) *detailsCache {
+	return &detailsCache{size: size, ttl: ttl, clock: systemClock{}, order: list.New(), entries: make(map[int]*list.Element)}
+}
+
+// get returns a copy of the cached details of a request, if present and fresh.
+func (d *detailsCache) get(requestID int) (*Request, bool) {
+	if d == nil {
+		return nil, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elem, ok := d.entries[requestID]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedRequest)
+	if d.clock.Now().After(entry.expires) {
+		d.order.Remove(elem)
+		delete(d.entries, requestID)
+		return nil, false
+	}
+	d.order.MoveToFront(elem)
+	request := entry.request
+	return &request, true
+}
+
+// put caches the details of a request, evicting the least recently used entry
+// if the cache is full.
+func (d *detailsCache) put(request *Request) {
+	if d == nil || d.size <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry := &cachedRequest{request: *request, expires: d.clock.Now().Add(d.ttl)}
+	if elem, ok := d.entries[request.ID]; ok {
+		elem.Value = entry
+		d.order.MoveToFront(elem)
+		return
+	}
+	d.entries[request.ID] = d.order.PushFront(entry)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*cachedRequest).request.ID)
+	}
+}
+
+// clear empties the cache.
+func (d *detailsCache) clear() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.order.Init()
+	clear(d.entries)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// attachmentKey identifies an attachment across runs.
+type attachmentKey struct {
+	RecordID   int
+	DocumentID int
+}
+
+// checksums returns the attachments of the manifest that have a recorded
+// checksum, keyed by record and document ID.
+func (m *Manifest) checksums() map[attachmentKey]AttachmentResult {
+	sums := make(map[attachmentKey]AttachmentResult)
+	for _, record := range m.Records {
+		for _, attachment := range record.Attachments {
+			if attachment.SHA256 != "" {
+				sums[attachmentKey{record.ID, attachment.DocumentID}] = attachment
+			}
+		}
+	}
+	return sums
+}
+
+// loadChecksums reads the checksums recorded by the previous run in the manifest
+// at path. A missing or unreadable manifest yields no checksums, so every
+// attachment is downloaded.
+func loadChecksums(path string) map[attachmentKey]AttachmentResult {
+	manifest, err := loadManifest(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[attachmentKey]AttachmentResult{}
+	}
+	if err != nil {
+		log.Printf("Warning: cannot read checksums from %s, downloading every attachment: %v", path, err)
+		return map[attachmentKey]AttachmentResult{}
+	}
+	return manifest.checksums()
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum and the size of a file.
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// unchangedFile reports whether the local copy of an attachment at path can be
+// kept: the previous run recorded it at the same relative path (relPath), the
+// server still reports the same upload time, and the file still has the
+// recorded checksum, once decompressed if it is stored gzipped. It returns the
+// checksum and size of the kept file.
+func (o *options) unchangedFile(requestID int, attachment File, relPath, path string) (string, int64, bool) {
+	previous, ok := o.checksums[attachmentKey{requestID, attachment.DocumentID}]
+	if !ok || previous.Path != relPath || previous.UploadedAt != attachment.UploadedAt {
+		return "", 0, false
+	}
+	sum, size, err := storedSHA256(path, previous.Compressed)
+	if err != nil || sum != previous.SHA256 {
+		return "", 0, false
+	}
+	return sum, size, true
+}
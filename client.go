@@ -1,48 +1,235 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// API endpoint paths
+// maxDrainBytes bounds how much of an unread response body is discarded to
+// reuse its connection; a longer body is cheaper to drop with its connection.
+const maxDrainBytes = 64 << 10
+
+// defaultAPIPrefix is the path prefix of all API endpoints.
+const defaultAPIPrefix = "/api/v2"
+
+// API endpoint paths, relative to the API prefix. The paths of the exported
+// objects start with their collection, requests or assessments.
 const (
-	requestsPath           = "/api/v2/requests"
-	requestDetailsPath     = "/api/v2/requests/%d"
-	requestAttachmentsPath = "/api/v2/requests/%d/attachments"
-	downloadFilePath       = "/api/v2/requests/%d/files/%d"
+	collectionPath         = "/%s"
+	programsPath           = "/programs"
+	requestDetailsPath     = "/%s/%d"
+	requestAttachmentsPath = "/%s/%d/attachments"
+	downloadFilePath       = "/%s/%d/files/%d"
+	customAttributesPath   = "/custom_attributes"
 )
 
 // Client is a client for the ZenGRC API. It manages all interactions with the API.
 type Client struct {
 	apiURL     string
+	apiPrefix  string
+	collection string
 	token      string
 	httpClient *http.Client
+	fileMode   os.FileMode
+
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retries        *retryBudget
+	retried        atomic.Int64 // Retries made by this client, out of the budget.
+	breaker        *circuitBreaker
+	trace          bool
+	skipBadPages   bool
+	pageRetries    int
+	pageBaseDelay  time.Duration
+	detailsCache   *detailsCache
+	listFields     []string
+	listQuery      url.Values
+	streamList     bool
+	pagination     string
+	fileTimeout    time.Duration
+	clock          Clock
+	schema         *schemaValidator
+
+	middleware    []Middleware
+	dial          dialConfig
+	tokenProvider TokenProvider
+	bearer        bearerAuth
+	userAgent     string
+}
+
+// Option configures optional behavior of a Client.
+type Option func(*Client)
+
+// WithFileMode sets the permissions applied to downloaded attachments.
+func WithFileMode(mode os.FileMode) Option {
+	return func(c *Client) {
+		c.fileMode = mode
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client, giving full control over the
+// transport, for example to add tracing or to stub responses in tests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent overrides the default User-Agent, zengrc-downloader/<version>.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithAPIPrefix replaces the path prefix of all API endpoints, /api/v2 by
+// default, for example for another API version or a gateway. The prefix must
+// have been checked with checkAPIPrefix.
+func WithAPIPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.apiPrefix = prefix
+	}
+}
+
+// checkAPIPrefix validates an API path prefix and returns it without its
+// trailing slash. The prefix must be an absolute path without a query or fragment.
+func checkAPIPrefix(prefix string) (string, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		return "", fmt.Errorf("invalid API prefix %q: must start with /", prefix)
+	}
+	if strings.ContainsAny(prefix, "?#\\ \t\n") || strings.Contains(prefix, "//") {
+		return "", fmt.Errorf("invalid API prefix %q: must be a plain path such as %s", prefix, defaultAPIPrefix)
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid API prefix %q: must not contain . or .. segments", prefix)
+		}
+	}
+	return strings.TrimSuffix(prefix, "/"), nil
+}
+
+// checkAPIURL validates the API URL, which must be an http or https URL with a
+// host. Plain HTTP is meant for local testing, such as against a mock server:
+// for any other host, it returns a warning since the credentials would be
+// sent in the clear.
+func checkAPIURL(apiURL string) (warning string, err error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API URL %q: %w", apiURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("invalid API URL %q: must be an https:// URL such as https://acme.api.zengrc.com", apiURL)
+	}
+	if u.Scheme == "http" && !isLoopbackHost(u.Hostname()) {
+		return fmt.Sprintf("the API URL %s uses plain http://; the token is sent in the clear to %s. Use https:// outside of local testing.", apiURL, u.Hostname()), nil
+	}
+	return "", nil
+}
+
+// isLoopbackHost reports whether host names the local machine: localhost, a
+// name under .localhost, or a loopback address.
+func isLoopbackHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// endpoint returns the path of an API endpoint: the API prefix followed by
+// format, formatted with args.
+func (c *Client) endpoint(format string, args ...any) string {
+	return c.apiPrefix + fmt.Sprintf(format, args...)
+}
+
+// WithFileTimeout bounds each attempt at downloading an attachment by d instead
+// of the overall HTTP client timeout. An attempt that times out is retried,
+// resuming where it stopped. Zero keeps the client timeout.
+func WithFileTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.fileTimeout = d
+	}
+}
+
+// fileRequestKey marks the context of attachment downloads.
+type fileRequestKey struct{}
+
+// withFileRequest marks ctx as belonging to an attachment download.
+func withFileRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fileRequestKey{}, true)
+}
+
+// httpClientFor returns the HTTP client for req. With a per-file timeout,
+// attachment downloads are bounded by their context only, not by the client
+// timeout meant for API calls.
+func (c *Client) httpClientFor(req *http.Request) *http.Client {
+	if c.fileTimeout <= 0 || req.Context().Value(fileRequestKey{}) == nil {
+		return c.httpClient
+	}
+	unbounded := *c.httpClient
+	unbounded.Timeout = 0
+	return &unbounded
 }
 
 // NewClient creates a new ZenGRC API client with an optimized HTTP client.
-func NewClient(apiURL, token string) *Client {
+func NewClient(apiURL, token string, opts ...Option) *Client {
 	// Configure a custom transport to optimize connection pooling and reuse.
 	transport := &http.Transport{
 		MaxIdleConns:    10,               // Max idle connections to keep open.
 		IdleConnTimeout: 30 * time.Second, // Timeout for idle connections.
 	}
 
-	return &Client{
-		apiURL: apiURL,
-		token:  token,
+	c := &Client{
+		apiURL:     apiURL,
+		apiPrefix:  defaultAPIPrefix,
+		collection: modeRequests,
+		token:      token,
 		httpClient: &http.Client{
 			Transport: transport,
 			Timeout:   60 * time.Second, // Set a timeout for HTTP requests.
 		},
+		fileMode:       defaultFileMode,
+		userAgent:      defaultUserAgent(),
+		dial:           dialConfig{timeout: defaultDialTimeout, keepAlive: defaultKeepAlive, dualStack: true},
+		maxRetries:     defaultMaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+		pageRetries:    defaultPageRetries,
+		pagination:     paginationLinks,
+		pageBaseDelay:  defaultPageBaseDelay,
+		retries:        &retryBudget{},
+		breaker:        &circuitBreaker{threshold: defaultBreakerThreshold, cooldown: defaultBreakerCooldown},
+		clock:          systemClock{},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Everything that tells the time goes by the client's clock.
+	if c.breaker != nil {
+		c.breaker.clock = c.clock
+	}
+	if c.detailsCache != nil {
+		c.detailsCache.clock = c.clock
+	}
+	c.dial.clock = c.clock
+	transport.DialContext = c.dial.dialContext()
+	c.httpClient = c.wrapTransport(c.httpClient)
+	return c
 }
 
 // ZenGRC API Data Structures
@@ -70,11 +257,26 @@ type CustomAttrValue struct {
 	Value interface{} `json:"value"`
 }
 
-// DetailsLinks represents the links for an object.
-type DetailsLinks struct {
-	Self struct {
-		Href string `json:"href"`
-	} `json:"self"`
+// UnmarshalJSON implements json.Unmarshaler. Numbers in the value, at any
+// depth, are decoded as json.Number rather than float64, so that large integers
+// such as IDs keep every digit and are saved exactly as the API returned them.
+func (v *CustomAttrValue) UnmarshalJSON(data []byte) error {
+	type plain CustomAttrValue
+	var attr struct {
+		plain
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &attr); err != nil {
+		return err
+	}
+	*v = CustomAttrValue(attr.plain)
+	v.Value = nil
+	if len(attr.Value) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(attr.Value))
+	dec.UseNumber()
+	return dec.Decode(&v.Value)
 }
 
 // ControlInfo represents basic control information.
@@ -135,6 +337,41 @@ type Request struct {
 	Type             string                     `json:"type"`
 	UpdatedAt        string                     `json:"updated_at"`
 	Verifiers        []PersonInfo               `json:"verifiers"`
+
+	// ETag is the entity tag of the details response, if the API sent one. It
+	// is kept in the state file rather than in the metadata.
+	ETag string `json:"-"`
+}
+
+// setETag implements etagged.
+func (r *Request) setETag(etag string) { r.ETag = etag }
+
+// GetDescription returns the request description, or an empty string if it is null.
+func (r *Request) GetDescription() string { return stringValue(r.Description) }
+
+// GetDueDate returns the request due date, or an empty string if it is null.
+func (r *Request) GetDueDate() string { return stringValue(r.DueDate) }
+
+// GetNotes returns the request notes, or an empty string if they are null.
+func (r *Request) GetNotes() string { return stringValue(r.Notes) }
+
+// GetTest returns the request test plan, or an empty string if it is null.
+func (r *Request) GetTest() string { return stringValue(r.Test) }
+
+// GetNotifyAssignee returns the notify_assignee flag, or false if it is null.
+func (r *Request) GetNotifyAssignee() bool {
+	if r.NotifyAssignee == nil {
+		return false
+	}
+	return *r.NotifyAssignee
+}
+
+// stringValue dereferences a nullable string, returning "" for nil.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
 
 // File represents a file attachment.
@@ -154,6 +391,29 @@ type RequestListResponse struct {
 	} `json:"links"`
 }
 
+// Program represents a ZenGRC program object.
+type Program struct {
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Code        string       `json:"code"`
+	Description *string      `json:"description"`
+	Status      string       `json:"status"`
+	Type        string       `json:"type"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+	Links       DetailsLinks `json:"links"`
+}
+
+// ProgramListResponse is the response from the API when listing programs.
+type ProgramListResponse struct {
+	Data  []Program `json:"data"`
+	Links struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"links"`
+}
+
 // AttachmentListResponse is the response from the API when listing attachments.
 type AttachmentListResponse struct {
 	Data struct {
@@ -161,73 +421,123 @@ type AttachmentListResponse struct {
 	} `json:"data"`
 }
 
-// newRequest creates a new HTTP request with the necessary headers for the ZenGRC API.
-func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
-	url := fmt.Sprintf("%s%s", c.apiURL, path)
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", basicAuth(c.token))
-	req.Header.Set("Content-Type", "application/json")
-	return req, nil
+// newRequest creates a new HTTP request for an API path. Its credentials and
+// headers are set by the client's transport when it is sent.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, c.apiURL+path, body)
 }
 
 // do executes an HTTP request and decodes the JSON response into the provided interface.
 func (c *Client) do(req *http.Request, v interface{}) error {
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
 	defer func() {
+		// Read what the decoder left, such as a trailing newline, so that the
+		// connection can be reused.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
 		if err := resp.Body.Close(); err != nil {
 			log.Printf("Error closing response body: %v", err)
 		}
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status: %s, body: %s", resp.Status, string(bodyBytes))
+	if err := checkResponse(resp); err != nil {
+		return err
 	}
 
-	if v != nil {
-		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+	// A 204 No Content (or any empty body) leaves v at its zero value, which
+	// callers treat as an empty result rather than an error.
+	if v != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil && err != io.EOF {
 			return err
 		}
 	}
+	if e, ok := v.(etagged); ok {
+		e.setETag(resp.Header.Get("ETag"))
+	}
 	return nil
 }
 
-// GetRequestDetails retrieves the details of a single request.
-func (c *Client) GetRequestDetails(requestID int) (*Request, error) {
-	path := fmt.Sprintf(requestDetailsPath, requestID)
-	req, err := c.newRequest("GET", path, nil)
+// etagged is implemented by the responses that keep the ETag header of the
+// response they were decoded from.
+type etagged interface {
+	setETag(etag string)
+}
+
+// checkResponse returns an *APIError if the response does not carry a 2xx status.
+// A 206 Partial Content is only accepted when the request asked for a byte range,
+// since a partial body would otherwise be silently mistaken for the full one.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if resp.StatusCode != http.StatusPartialContent || (resp.Request != nil && resp.Request.Header.Get("Range") != "") {
+			return nil
+		}
+	}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(bodyBytes),
+		Message:    parseErrorMessage(bodyBytes),
+	}
+}
+
+// GetRequestDetails retrieves the details of a single request, from the
+// details cache if enabled.
+func (c *Client) GetRequestDetails(ctx context.Context, requestID int) (*Request, error) {
+	if request, ok := c.detailsCache.get(requestID); ok {
+		return request, nil
+	}
+
+	path := c.endpoint(requestDetailsPath, c.collection, requestID)
+	req, err := c.newRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var request Request
-	if err := c.do(req, &request); err != nil {
+	if err := c.doChecked(schemaRequest, req, &request); err != nil {
 		return nil, err
 	}
 
+	c.detailsCache.put(&request)
 	return &request, nil
 }
 
 // GetRequests retrieves a list of requests, handling pagination via the cursor.
-func (c *Client) GetRequests(cursor string) (*RequestListResponse, error) {
-	path := requestsPath
+func (c *Client) GetRequests(ctx context.Context, cursor string) (*RequestListResponse, error) {
+	path := c.requestsListPath()
 	if cursor != "" {
 		path = cursor // The cursor from the API response is a full path.
 	}
 
-	req, err := c.newRequest("GET", path, nil)
+	req, err := c.newRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var resp RequestListResponse
+	if err := c.doChecked(schemaRequestList, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetPrograms retrieves a list of programs, handling pagination via the cursor.
+func (c *Client) GetPrograms(ctx context.Context, cursor string) (*ProgramListResponse, error) {
+	path := c.endpoint(programsPath)
+	if cursor != "" {
+		path = cursor // The cursor from the API response is a full path.
+	}
+
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ProgramListResponse
 	if err := c.do(req, &resp); err != nil {
 		return nil, err
 	}
@@ -235,72 +545,306 @@ func (c *Client) GetRequests(cursor string) (*RequestListResponse, error) {
 	return &resp, nil
 }
 
+// EachRequest walks every page of the request list, calling fn for each request in
+// order. It stops at the last page, or at the first error from the API or from fn.
+// A page is only given up on once the client's retries are exhausted; with
+// WithSkipBadPages, such a page is then skipped instead of ending the walk.
+func (c *Client) EachRequest(ctx context.Context, fn func(Request) error) error {
+	_, err := c.EachRequestFrom(ctx, "", 0, fn)
+	return err
+}
+
+// EachRequestFrom is like EachRequest, but starts at the page of cursor, the
+// first page if empty, and stops after maxPages pages if maxPages is positive.
+// It returns the cursor of the page after the last one it walked, which is
+// empty once the last page of the list has been walked. Skipped pages count
+// toward maxPages.
+func (c *Client) EachRequestFrom(ctx context.Context, cursor string, maxPages int, fn func(Request) error) (string, error) {
+	badPages := 0
+	// The first request of each page detects an API that ignores the query
+	// parameter of a counting pagination strategy and keeps returning one page.
+	var first, previousFirst int
+	walk := func(request Request) error {
+		if first == 0 {
+			first = request.ID
+		}
+		return fn(request)
+	}
+	for pages := 0; maxPages <= 0 || pages < maxPages; pages++ {
+		previousFirst, first = first, 0
+		next, err := c.walkRequestsPage(ctx, cursor, walk)
+		var callbackErr *callbackError
+		if errors.As(err, &callbackErr) {
+			return cursor, callbackErr.err
+		}
+		if err != nil {
+			// Consecutive failures mean the listing as a whole is broken, not one page.
+			next, ok := nextPageCursor(cursor, c.requestsListPath())
+			badPages++
+			if !c.skipBadPages || ctx.Err() != nil || !ok || badPages > maxConsecutiveBadPages {
+				return cursor, err
+			}
+			log.Printf("Skipping request list page %s after error: %v", c.pageLabel(cursor), err)
+			cursor = next
+			continue
+		}
+		badPages = 0
+		if c.pagination != paginationLinks && first != 0 && first == previousFirst {
+			return cursor, fmt.Errorf("request list page %s repeats the previous page: the API seems to ignore %s pagination", c.pageLabel(cursor), c.pagination)
+		}
+
+		// Handle pagination.
+		if next == "" {
+			return "", nil
+		}
+		cursor = next
+	}
+	return cursor, nil
+}
+
 // GetAttachments retrieves the attachments for a given request.
-func (c *Client) GetAttachments(requestID int) ([]File, error) {
-	path := fmt.Sprintf(requestAttachmentsPath, requestID)
-	req, err := c.newRequest("GET", path, nil)
+func (c *Client) GetAttachments(ctx context.Context, requestID int) ([]File, error) {
+	return c.GetAttachmentsFor(ctx, &Request{ID: requestID})
+}
+
+// GetAttachmentsFor retrieves the attachments of a request, following its
+// attachments link if the API gave one, and the usual endpoint otherwise.
+func (c *Client) GetAttachmentsFor(ctx context.Context, request *Request) ([]File, error) {
+	path, ok := c.linkPath(request.Links.Href(attachmentsRel))
+	if !ok {
+		path = c.endpoint(requestAttachmentsPath, c.collection, request.ID)
+	}
+	req, err := c.newRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var resp AttachmentListResponse
-	if err := c.do(req, &resp); err != nil {
+	if err := c.doChecked(schemaAttachmentList, req, &resp); err != nil {
 		return nil, err
 	}
 
 	return resp.Data.Files, nil
 }
 
+// ErrAttachmentExists is returned by DownloadAttachment when the target file already
+// exists and overwriting is disabled.
+var ErrAttachmentExists = errors.New("attachment already exists")
+
 // DownloadAttachment downloads a single attachment to the specified output directory.
-// It includes a check to prevent overwriting existing files unless the overwrite flag is true.
-func (c *Client) DownloadAttachment(requestID int, attachment File, outputDir string, overwrite bool) error {
+// It includes a check to prevent overwriting existing files unless the overwrite flag is true,
+// in which case ErrAttachmentExists is returned and nothing is written. The attachment is
+// streamed into a temporary file that is renamed into place only once complete, so a failed
+// download never leaves a partial file or clobbers an existing one.
+//
+// Error responses, 5xx included, are retried by send before anything is written.
+// A transfer cut off part way is retried with backoff from scratch, into a new
+// temporary file once the partial one is removed; with a per-file timeout, it is
+// resumed at the byte reached instead.
+func (c *Client) DownloadAttachment(ctx context.Context, requestID int, attachment File, outputDir string, overwrite bool) error {
+	return c.downloadAttachment(ctx, requestID, attachment, outputDir, overwrite, nil)
+}
+
+// downloadAttachment is DownloadAttachment, timing the transfer into stats if not nil.
+func (c *Client) downloadAttachment(ctx context.Context, requestID int, attachment File, outputDir string, overwrite bool, stats *transferStats) error {
 	filePath := filepath.Join(outputDir, attachment.Name)
 
+	// Stop before touching the disk once the run is cancelled.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// If overwrite is false, check if the file already exists.
 	if !overwrite {
 		if _, err := os.Stat(filePath); err == nil {
-			fmt.Printf("File %s already exists. Skipping.\n", filePath)
-			return nil
+			return ErrAttachmentExists
 		}
 	}
 
-	path := fmt.Sprintf(downloadFilePath, requestID, attachment.DocumentID)
-	req, err := c.newRequest("GET", path, nil)
-	if err != nil {
-		return err
+	for attempt := 0; ; attempt++ {
+		err := c.downloadToFile(ctx, requestID, attachment, outputDir, filePath, stats)
+		if err == nil || c.fileTimeout > 0 || !interruptedDownload(ctx, err) || attempt >= c.maxRetries || !c.takeRetry() {
+			return err
+		}
+		delay := backoff(c.retryBaseDelay, attempt)
+		log.Printf("Download of %s for record %d was interrupted, starting over in %s (%d/%d): %v",
+			attachment.Name, requestID, delay.Round(time.Millisecond), attempt+1, c.maxRetries, err)
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
 	}
+}
+
+// interruptedDownload reports whether a download failed because its transfer
+// was cut off, as opposed to a failure that trying again would not fix.
+func interruptedDownload(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && classifyError(err) == categoryNetwork
+}
 
-	resp, err := c.httpClient.Do(req)
+// downloadToFile makes one attempt at downloading an attachment to filePath
+// through a temporary file in outputDir, which is removed if the attempt fails.
+func (c *Client) downloadToFile(ctx context.Context, requestID int, attachment File, outputDir, filePath string, stats *transferStats) error {
+	// Create the temporary file, applying the configured mode explicitly so it is not
+	// narrowed by the umask.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(outputDir, "."+attachment.Name+".*.part")
 	if err != nil {
 		return err
 	}
+	tmpPath := out.Name()
 	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
-		}
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status: %s, body: %s", resp.Status, string(bodyBytes))
+	if err := out.Chmod(c.fileMode); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := c.downloadResumable(ctx, requestID, attachment, out, stats); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return renameFile(tmpPath, filePath)
+}
+
+// downloadResumable streams an attachment into out. With a per-file timeout, an
+// attempt that times out or is cut off is retried, up to the retry limit, by
+// requesting only the bytes still missing; if the server ignores the range, the
+// file restarts from scratch.
+func (c *Client) downloadResumable(ctx context.Context, requestID int, attachment File, out *os.File, stats *transferStats) error {
+	var written int64
+	restart := func() error {
+		written = 0
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		_, err := out.Seek(0, io.SeekStart)
+		return err
+	}
+	w := writerFunc(func(p []byte) (int, error) {
+		n, err := out.Write(p)
+		written += int64(n)
+		return n, err
+	})
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if c.fileTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, c.fileTimeout)
+		}
+		err := c.download(attemptCtx, requestID, attachment, w, written, restart, stats)
+		cancel()
+
+		timedOut := errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+		interrupted := c.fileTimeout > 0 && !timedOut && err != nil && interruptedDownload(ctx, err)
+		if !(timedOut || interrupted) || attempt >= c.maxRetries || !c.takeRetry() {
+			if timedOut {
+				return fmt.Errorf("download of %s timed out after %d attempts of %s: %w", attachment.Name, attempt+1, c.fileTimeout, err)
+			}
+			return err
+		}
+		if timedOut {
+			log.Printf("Download of %s for record %d timed out after %s; resuming at byte %d", attachment.Name, requestID, c.fileTimeout, written)
+			continue
+		}
+		delay := backoff(c.retryBaseDelay, attempt)
+		log.Printf("Download of %s for record %d was interrupted; resuming at byte %d in %s: %v",
+			attachment.Name, requestID, written, delay.Round(time.Millisecond), err)
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+// Write calls f(p).
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// DownloadAttachmentTo streams a single attachment into w, without touching the
+// filesystem. It allows library callers to keep attachments in memory or forward them.
+func (c *Client) DownloadAttachmentTo(ctx context.Context, requestID int, attachment File, w io.Writer) error {
+	return c.download(ctx, requestID, attachment, w, 0, nil, nil)
+}
+
+// download streams an attachment into w. A positive offset requests only the
+// bytes from offset on; if the server answers with the whole file instead,
+// restart is called before anything is written. The copy of the body is timed
+// into stats if not nil.
+func (c *Client) download(ctx context.Context, requestID int, attachment File, w io.Writer, offset int64, restart func() error, stats *transferStats) error {
+	path := c.endpoint(downloadFilePath, c.collection, requestID, attachment.DocumentID)
+	req, err := c.newRequest(withFileRequest(ctx), "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	// Create the output file.
-	out, err := os.Create(filePath)
+	resp, err := c.send(req)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if err := out.Close(); err != nil {
-			log.Printf("Error closing file %s: %v", filePath, err)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
 		}
 	}()
 
-	// Copy the response body to the file.
-	_, err = io.Copy(out, resp.Body)
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		if err := restart(); err != nil {
+			return err
+		}
+	}
+
+	// Copy the response body to the writer.
+	if stats == nil {
+		_, err = io.Copy(w, resp.Body)
+		return err
+	}
+	start := c.clock.Now()
+	n, err := io.Copy(w, resp.Body)
+	stats.add(start, c.clock.Now(), n)
 	return err
 }
 
+// transferStats times the transfer of an attachment. Resumed and restarted
+// attempts add up: the transfer spans from the start of the first copy to the
+// end of the last, and counts every byte received.
+type transferStats struct {
+	start, end time.Time
+	bytes      int64
+	elapsed    time.Duration
+}
+
+// add accounts for a copy of n bytes from start to end.
+func (s *transferStats) add(start, end time.Time, n int64) {
+	if s.start.IsZero() {
+		s.start = start
+	}
+	s.end = end
+	s.bytes += n
+	s.elapsed += end.Sub(start)
+}
+
+// mbPerSecond returns the throughput of the copies in megabytes (10^6 bytes)
+// per second, or 0 if it cannot be measured.
+func (s *transferStats) mbPerSecond() float64 {
+	if s.elapsed <= 0 {
+		return 0
+	}
+	return float64(s.bytes) / 1e6 / s.elapsed.Seconds()
+}
+
 // basicAuth returns a base64 encoded string for Basic Authentication.
 func basicAuth(token string) string {
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(token))
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of the API served by handler.
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "key:secret", opts...)
+}
+
+func TestEmptyListNoContent(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx := context.Background()
+
+	list, err := client.GetRequests(ctx, "")
+	if err != nil {
+		t.Fatalf("GetRequests: %v", err)
+	}
+	if len(list.Data) != 0 {
+		t.Errorf("GetRequests returned %d requests, want none", len(list.Data))
+	}
+
+	calls := 0
+	if err := client.EachRequest(ctx, func(Request) error { calls++; return nil }); err != nil {
+		t.Fatalf("EachRequest: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("EachRequest called fn %d times, want none", calls)
+	}
+
+	files, err := client.GetAttachments(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetAttachments: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("GetAttachments returned %d files, want none", len(files))
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		rangeReq bool
+		wantErr  bool
+	}{
+		{"ok", http.StatusOK, false, false},
+		{"created", http.StatusCreated, false, false},
+		{"accepted", http.StatusAccepted, false, false},
+		{"no content", http.StatusNoContent, false, false},
+		{"partial content for a range", http.StatusPartialContent, true, false},
+		{"partial content without a range", http.StatusPartialContent, false, true},
+		{"redirect", http.StatusFound, false, true},
+		{"not found", http.StatusNotFound, false, true},
+		{"server error", http.StatusInternalServerError, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.rangeReq {
+				req.Header.Set("Range", "bytes=10-")
+			}
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Request: req, Body: http.NoBody}
+			if err := checkResponse(resp); (err != nil) != tt.wantErr {
+				t.Errorf("checkResponse(%d) = %v, want error %t", tt.status, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestOptionalFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		json            string
+		wantDescription string
+		wantDueDate     string
+		wantNotes       string
+		wantTest        string
+		wantNotify      bool
+	}{
+		{
+			name: "missing",
+			json: `{"id": 1, "title": "Evidence"}`,
+		},
+		{
+			name: "null",
+			json: `{"id": 1, "title": "Evidence", "description": null, "due_date": null, "notes": null, "test": null, "notify_assignee": null}`,
+		},
+		{
+			name:            "set",
+			json:            `{"id": 1, "title": "Evidence", "description": "d", "due_date": "2024-05-01", "notes": "n", "test": "t", "notify_assignee": true}`,
+			wantDescription: "d",
+			wantDueDate:     "2024-05-01",
+			wantNotes:       "n",
+			wantTest:        "t",
+			wantNotify:      true,
+		},
+		{
+			name: "empty",
+			json: `{"id": 1, "title": "Evidence", "description": "", "due_date": "", "notes": "", "test": "", "notify_assignee": false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request Request
+			if err := json.Unmarshal([]byte(tt.json), &request); err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+			if got := request.GetDescription(); got != tt.wantDescription {
+				t.Errorf("GetDescription() = %q, want %q", got, tt.wantDescription)
+			}
+			if got := request.GetDueDate(); got != tt.wantDueDate {
+				t.Errorf("GetDueDate() = %q, want %q", got, tt.wantDueDate)
+			}
+			if got := request.GetNotes(); got != tt.wantNotes {
+				t.Errorf("GetNotes() = %q, want %q", got, tt.wantNotes)
+			}
+			if got := request.GetTest(); got != tt.wantTest {
+				t.Errorf("GetTest() = %q, want %q", got, tt.wantTest)
+			}
+			if got := request.GetNotifyAssignee(); got != tt.wantNotify {
+				t.Errorf("GetNotifyAssignee() = %t, want %t", got, tt.wantNotify)
+			}
+
+			// The consumers of these fields must not dereference them.
+			_ = inlineLinks(&request)
+			compare, err := orderFunc(orderDueDate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = compare(request, Request{ID: 2})
+		})
+	}
+}
+
+func TestRequestDetailsETag(t *testing.T) {
+	for _, validate := range []bool{false, true} {
+		var opts []Option
+		if validate {
+			opts = append(opts, WithSchemaValidation(false))
+		}
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			_, _ = w.Write([]byte(`{"id": 7, "title": "Evidence"}`))
+		}), opts...)
+
+		request, err := client.GetRequestDetails(context.Background(), 7)
+		if err != nil {
+			t.Fatalf("GetRequestDetails (validating %t): %v", validate, err)
+		}
+		if request.ETag != `"abc"` || request.ID != 7 {
+			t.Errorf("GetRequestDetails (validating %t) = ID %d, ETag %s; want 7 and \"abc\"", validate, request.ID, request.ETag)
+		}
+	}
+}
+
+func TestDownloadAttachmentRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter)
+	}{
+		{"server error", func(w http.ResponseWriter) {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+		}},
+		{"cut off", func(w http.ResponseWriter) {
+			// The response ends before the announced length.
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, "partial")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			calls := 0
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls++; calls == 1 {
+					tt.fail(w)
+					return
+				}
+				fmt.Fprint(w, "content")
+			}), WithRetries(3, time.Second), WithClock(clock))
+			dir := t.TempDir()
+
+			if err := client.DownloadAttachment(context.Background(), 1, File{DocumentID: 1, Name: "a.txt"}, dir, false); err != nil {
+				t.Fatalf("DownloadAttachment: %v", err)
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "content" {
+				t.Errorf("a.txt = %q, %v; want %q", data, err, "content")
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("directory holds %d files, want only a.txt without partial files", len(entries))
+			}
+			if waits := clock.recorded(); calls != 2 || len(waits) != 1 || waits[0] <= 0 || waits[0] > time.Second {
+				t.Errorf("%d calls after waits %v, want 2 after one backoff within 1s", calls, waits)
+			}
+		})
+	}
+}
+
+func TestCustomAttrValueLargeInteger(t *testing.T) {
+	const data = `{"custom_attributes": {"external_id": {"id": 7, "title": "External ID", "value": 12345678901234567890}, "links": {"id": 8, "value": {"ids": [9007199254740993]}}}}`
+	var request Request
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		t.Fatal(err)
+	}
+	if got := request.CustomAttributes["external_id"].Value; got != json.Number("12345678901234567890") {
+		t.Errorf("value = %#v, want the exact number", got)
+	}
+
+	// Nested numbers keep their digits too, and are saved as the API returned them.
+	saved, err := json.Marshal(request.CustomAttributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"12345678901234567890", "9007199254740993"} {
+		if !strings.Contains(string(saved), want) {
+			t.Errorf("saved %s, want %s kept exactly", saved, want)
+		}
+	}
+}
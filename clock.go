@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of a Client: the current time checked by its
+// caches and circuit breaker, and the waits between its retries. Replacing it
+// with WithClock lets tests control time deterministically instead of sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// WithClock sets the clock of the client. The default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// systemClock is the Clock of the operating system.
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time { return time.Now() }
+
+// After implements Clock.
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// sleep pauses for d, returning early with the context's error if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	return sleepOn(ctx, systemClock{}, d)
+}
+
+// sleepOn is sleep measured by clock.
+func sleepOn(ctx context.Context, clock Clock, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
+
+// sleep is sleep measured by the client's clock.
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	return sleepOn(ctx, c.clock, d)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressedExt is appended to the name of an attachment stored gzipped by -compress.
+const compressedExt = ".gz"
+
+// incompressibleExts are the extensions of file types that are compressed
+// already, or nearly so, and that -compress stores as they are: archives,
+// images, audio and video, PDF, and Office Open XML and OpenDocument files,
+// which are zip archives.
+var incompressibleExts = map[string]bool{
+	".7z": true, ".br": true, ".bz2": true, ".gz": true, ".lz": true, ".rar": true,
+	".tgz": true, ".xz": true, ".zip": true, ".zst": true,
+	".gif": true, ".heic": true, ".jpeg": true, ".jpg": true, ".png": true, ".webp": true,
+	".avi": true, ".m4a": true, ".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".ogg": true,
+	".pdf": true, ".docx": true, ".pptx": true, ".xlsx": true, ".odp": true, ".ods": true, ".odt": true,
+}
+
+// shouldCompress reports whether -compress stores an attachment gzipped, which
+// it does unless its extension tells that it is compressed already.
+func shouldCompress(name string) bool {
+	return !incompressibleExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// compressFile replaces the file at path with a gzipped copy at path plus
+// compressedExt, written through a temporary file so that it appears complete.
+// It returns the path and size of the compressed file.
+func compressFile(path string, mode os.FileMode) (string, int64, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	target := path + compressedExt
+	out, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpPath := out.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
+	}()
+
+	if err := out.Chmod(mode); err != nil {
+		_ = out.Close()
+		return "", 0, err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return "", 0, err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return "", 0, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		_ = out.Close()
+		return "", 0, err
+	}
+	if err := out.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := renameFile(tmpPath, target); err != nil {
+		return "", 0, err
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Warning: cannot remove %s once compressed: %v", path, err)
+	}
+	return target, info.Size(), nil
+}
+
+// storedSHA256 is fileSHA256 for an attachment as stored: the checksum and size
+// of the original content, decompressed first if the attachment is stored
+// gzipped.
+func storedSHA256(path string, compressed bool) (string, int64, error) {
+	if !compressed {
+		return fileSHA256(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, zr)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := zr.Close(); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirmDownload estimates the size of the export by listing the selected
+// requests and counting their attachments, then asks the user to proceed. The
+// prompt is skipped, and the run proceeds, when assumeYes is set or when
+// standard input is not a terminal.
+func confirmDownload(ctx context.Context, client *Client, opts *options, workers int, assumeYes bool) (bool, error) {
+	entries, err := buildIndex(ctx, client, opts.filters, true, workers)
+	if err != nil {
+		return false, fmt.Errorf("failed to estimate the export: %w", err)
+	}
+
+	attachments := 0
+	for _, entry := range entries {
+		if entry.AttachmentCount != nil {
+			attachments += *entry.AttachmentCount
+		}
+	}
+	console.Printf("This run will export %d records with %d attachments.\n", len(entries), attachments)
+
+	if assumeYes || !isTerminal(os.Stdin) {
+		return true, nil
+	}
+
+	console.Printf("Proceed? [y/N] ")
+	console.Flush()
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// consoleMessage is a single piece of output bound for a destination writer.
+type consoleMessage struct {
+	w    io.Writer
+	text []byte
+}
+
+// printer serializes human-facing output through a single goroutine so that
+// messages from concurrent workers never interleave mid-line.
+type printer struct {
+	out      io.Writer
+	messages chan consoleMessage
+	done     chan struct{}
+}
+
+// console is the printer used for all output of the application. Standard log
+// output is routed through it as well, see main.
+var console = newPrinter()
+
+// newPrinter creates a printer and starts its output goroutine.
+func newPrinter() *printer {
+	p := &printer{
+		out:      os.Stdout,
+		messages: make(chan consoleMessage, 256),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		for msg := range p.messages {
+			_, _ = msg.w.Write(msg.text)
+		}
+	}()
+	return p
+}
+
+// SetOutput changes the destination of Printf and Println, which is standard
+// output by default. It must be called before any message is printed.
+func (p *printer) SetOutput(w io.Writer) {
+	p.out = w
+}
+
+// Printf formats a message and queues it for the printer's output.
+func (p *printer) Printf(format string, a ...any) {
+	p.messages <- consoleMessage{w: p.out, text: []byte(fmt.Sprintf(format, a...))}
+}
+
+// Println formats its operands like fmt.Println and queues them for the printer's output.
+func (p *printer) Println(a ...any) {
+	p.messages <- consoleMessage{w: p.out, text: []byte(fmt.Sprintln(a...))}
+}
+
+// Writer returns an io.Writer that queues each write for w. It is used to route
+// the standard logger through the printer.
+func (p *printer) Writer(w io.Writer) io.Writer {
+	return printerWriter{p: p, w: w}
+}
+
+// Flush blocks until all output queued so far has been written.
+func (p *printer) Flush() {
+	flushed := make(chan struct{})
+	p.messages <- consoleMessage{w: flushWriter(flushed)}
+	<-flushed
+}
+
+// flushWriter is a marker destination that signals when the printer reaches it.
+type flushWriter chan struct{}
+
+// Write closes the channel, signalling that everything queued before it was written.
+func (f flushWriter) Write([]byte) (int, error) {
+	close(f)
+	return 0, nil
+}
+
+// Close flushes all queued output and stops the printer goroutine.
+func (p *printer) Close() {
+	close(p.messages)
+	<-p.done
+}
+
+// printerWriter adapts a printer to io.Writer for a fixed destination.
+type printerWriter struct {
+	p *printer
+	w io.Writer
+}
+
+// Write queues a copy of b, since callers such as the log package reuse their buffer.
+func (pw printerWriter) Write(b []byte) (int, error) {
+	pw.p.messages <- consoleMessage{w: pw.w, text: append([]byte(nil), b...)}
+	return len(b), nil
+}
+
+// exit flushes pending console output and terminates the program with code.
+func exit(code int) {
+	console.Close()
+	os.Exit(code)
+}
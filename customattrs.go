@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+)
+
+// customAttributesFileName is the name of the custom attribute definitions file
+// written to the output directory.
+const customAttributesFileName = "custom_attributes.json"
+
+// CustomAttributeDefinition describes a custom attribute, so that the values in
+// a request's custom_attributes, keyed by attribute ID, can be interpreted.
+type CustomAttributeDefinition struct {
+	ID                 int     `json:"id"`
+	Title              string  `json:"title"`
+	AttributeType      string  `json:"attribute_type"`
+	DefinitionType     string  `json:"definition_type"`
+	HelpText           *string `json:"helptext"`
+	Mandatory          bool    `json:"mandatory"`
+	MultiChoiceOptions *string `json:"multi_choice_options"`
+}
+
+// CustomAttributeListResponse is the response from the API when listing custom
+// attribute definitions.
+type CustomAttributeListResponse struct {
+	Data  []CustomAttributeDefinition `json:"data"`
+	Links struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"links"`
+}
+
+// GetCustomAttributeDefinitions retrieves the definitions of all custom
+// attributes, walking every page of the list.
+func (c *Client) GetCustomAttributeDefinitions(ctx context.Context) ([]CustomAttributeDefinition, error) {
+	var definitions []CustomAttributeDefinition
+	path := c.endpoint(customAttributesPath)
+	for {
+		req, err := c.newRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		var resp CustomAttributeListResponse
+		if err := c.do(req, &resp); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, resp.Data...)
+		if resp.Links.Next.Href == "" {
+			return definitions, nil
+		}
+		path = resp.Links.Next.Href // The cursor from the API response is a full path.
+	}
+}
+
+// saveCustomAttributeDefinitions fetches the custom attribute definitions and
+// saves them to the output directory, returning the path written. An instance
+// that does not expose the definitions is logged and yields an empty path.
+func saveCustomAttributeDefinitions(ctx context.Context, client *Client, opts *options) (string, error) {
+	definitions, err := client.GetCustomAttributeDefinitions(ctx)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		log.Printf("Warning: the API does not expose custom attribute definitions; %s is not written", customAttributesFileName)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(definitions, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(opts.outputDir, customAttributesFileName)
+	return path, writeFile(path, data, opts.fileMode)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Default connection settings of the client's transport.
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// dialConfig holds the connection settings of the client's transport.
+type dialConfig struct {
+	timeout   time.Duration
+	keepAlive time.Duration
+	dualStack bool
+	dnsTTL    time.Duration
+	clock     Clock
+}
+
+// WithDialer sets how the client's transport opens connections: the connect
+// timeout, the TCP keep-alive period (negative disables keep-alives), and
+// whether IPv6 and IPv4 addresses are raced ("Happy Eyeballs"). It has no effect
+// with WithHTTPClient, whose transport is used as is.
+func WithDialer(timeout, keepAlive time.Duration, dualStack bool) Option {
+	return func(c *Client) {
+		c.dial.timeout = timeout
+		c.dial.keepAlive = keepAlive
+		c.dial.dualStack = dualStack
+	}
+}
+
+// WithDNSCache caches the addresses of the hosts the client connects to for
+// ttl, sparing the resolver on long runs against a single host. Zero disables
+// the cache. Like WithDialer, it has no effect with WithHTTPClient.
+func WithDNSCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.dial.dnsTTL = ttl
+	}
+}
+
+// dialContext returns the DialContext function of the transport.
+func (d dialConfig) dialContext() func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: d.timeout, KeepAlive: d.keepAlive}
+	if !d.dualStack {
+		dialer.FallbackDelay = -1
+	}
+	if d.dnsTTL <= 0 {
+		return dialer.DialContext
+	}
+	cache := &dnsCache{ttl: d.dnsTTL, clock: d.clock, entries: make(map[string]dnsEntry)}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return cache.dial(ctx, dialer, network, address)
+	}
+}
+
+// dnsCache caches the addresses of host names. It is safe for concurrent use.
+type dnsCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// dnsEntry is a cached lookup result.
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// lookup returns the addresses of host, from the cache while they are fresh.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: c.clock.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// forget drops the cached addresses of host, so that the next dial resolves
+// it again.
+func (c *dnsCache) forget(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, host)
+}
+
+// dial connects to address, trying the cached addresses of its host in turn.
+// If none of them accepts the connection, they are dropped from the cache.
+func (c *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	c.forget(host)
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// diskGuard handles writes failing because the disk is full. Rather than
+// failing every remaining file, it stops the run on the first such failure or,
+// with a wait, pauses the failing write and tries it again. A nil guard lets
+// every error through unchanged.
+type diskGuard struct {
+	wait   time.Duration
+	cancel context.CancelCauseFunc
+
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+}
+
+// newDiskGuard creates a guard that cancels the run with cancel, or, if wait is
+// positive, waits that long before each new attempt at a failed write.
+func newDiskGuard(wait time.Duration, cancel context.CancelCauseFunc) *diskGuard {
+	return &diskGuard{wait: wait, cancel: cancel}
+}
+
+// do runs the write fn, describing it as what in log messages. If it fails
+// because the disk is full, do either stops the run and returns the error, or
+// waits and runs fn again until it succeeds, fails otherwise, or ctx is done.
+func (g *diskGuard) do(ctx context.Context, what string, fn func() error) error {
+	for {
+		err := fn()
+		if g == nil || !isDiskFull(err) {
+			return err
+		}
+		if g.wait <= 0 {
+			g.stop(err)
+			return err
+		}
+		log.Printf("Disk full while writing %s; retrying in %s: %v", what, g.wait, err)
+		if sleep(ctx, g.wait) != nil {
+			return err
+		}
+	}
+}
+
+// stop cancels the run after a disk-full error, logging it once.
+func (g *diskGuard) stop(err error) {
+	g.once.Do(func() {
+		log.Printf("Fatal: the disk is full, stopping the run: %v. Free up space, then run again with -resume-run or -incremental, or use -wait-on-disk-full to pause instead.", err)
+		g.mu.Lock()
+		g.err = err
+		g.mu.Unlock()
+		g.cancel(err)
+	})
+}
+
+// stopped returns the disk-full error that stopped the run, if any.
+func (g *diskGuard) stopped() error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
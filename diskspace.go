@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// GetAttachmentSize returns the size of an attachment from the Content-Length
+// of a HEAD request on its download endpoint, without downloading it. It
+// returns -1 if the API does not report the size.
+func (c *Client) GetAttachmentSize(ctx context.Context, requestID int, attachment File) (int64, error) {
+	path := c.endpoint(downloadFilePath, c.collection, requestID, attachment.DocumentID)
+	req, err := c.newRequest(withFileRequest(ctx), http.MethodHead, path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+// downloadEstimate is the expected size of the attachments of an export.
+type downloadEstimate struct {
+	Attachments int
+	Bytes       int64
+	// Unknown counts the attachments whose size could not be determined; they
+	// are not included in Bytes.
+	Unknown int
+}
+
+// estimateDownload lists the selected requests and their attachments, and adds
+// up the attachment sizes reported by HEAD requests, running up to workers
+// requests at a time. Files already present locally are counted as well.
+func estimateDownload(ctx context.Context, client *Client, opts *options, workers int) (downloadEstimate, error) {
+	var ids []int
+	err := client.EachRequest(ctx, func(request Request) error {
+		if selected(request, opts.filters) {
+			ids = append(ids, request.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return downloadEstimate{}, err
+	}
+
+	var attachments, unknown atomic.Int64
+	var bytes atomic.Int64
+	sem := make(chan struct{}, max(1, workers))
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			files, err := client.GetAttachments(ctx, id)
+			if err != nil {
+				log.Printf("Error getting attachments for record %d: %v", id, err)
+				return
+			}
+			if opts.latestOnly {
+				files, _ = latestAttachments(files)
+			}
+			for _, file := range files {
+				attachments.Add(1)
+				size, err := client.GetAttachmentSize(ctx, id, file)
+				if err != nil || size < 0 {
+					unknown.Add(1)
+					continue
+				}
+				bytes.Add(size)
+			}
+		}()
+	}
+	wg.Wait()
+	return downloadEstimate{Attachments: int(attachments.Load()), Bytes: bytes.Load(), Unknown: int(unknown.Load())}, ctx.Err()
+}
+
+// checkDiskSpace estimates the size of the export and compares it with the
+// space available in dir. It reports false, after printing why, if the export
+// does not fit.
+func checkDiskSpace(ctx context.Context, client *Client, opts *options, dir string, workers int) (bool, error) {
+	available, err := availableSpace(dir)
+	if err != nil {
+		log.Printf("Warning: cannot determine the free space in %s, skipping the disk space check: %v", dir, err)
+		return true, nil
+	}
+
+	estimate, err := estimateDownload(ctx, client, opts, workers)
+	if err != nil {
+		return false, fmt.Errorf("failed to estimate the export: %w", err)
+	}
+	console.Printf("The attachments of this run take about %s; %s is available in %s.\n", formatBytes(estimate.Bytes), formatBytes(int64(available)), dir)
+	if estimate.Unknown > 0 {
+		log.Printf("Warning: the size of %d of %d attachments is unknown and not included in the estimate", estimate.Unknown, estimate.Attachments)
+	}
+	return uint64(estimate.Bytes) <= available, nil
+}
+
+// formatBytes renders a byte count with a binary unit, such as "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
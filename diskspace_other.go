@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// availableSpace is not implemented on this platform.
+func availableSpace(dir string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
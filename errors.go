@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// APIError is returned when the API answers with a non-successful status.
+// Message holds the human-readable details parsed from a JSON error body, if any.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	Message    string
+}
+
+// Error implements the error interface, preferring the parsed message over the raw body.
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("API request failed with status: %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("API request failed with status: %s, body: %s", e.Status, e.Body)
+}
+
+// apiErrorBody is the shape of a JSON error response from the API.
+type apiErrorBody struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+// parseErrorMessage extracts the titles and details of a JSON error body, joined
+// with "; ". It returns an empty string if the body does not have that shape.
+func parseErrorMessage(body []byte) string {
+	var parsed apiErrorBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ""
+	}
+
+	var messages []string
+	for _, e := range parsed.Errors {
+		switch {
+		case e.Title != "" && e.Detail != "":
+			messages = append(messages, e.Title+": "+e.Detail)
+		case e.Detail != "":
+			messages = append(messages, e.Detail)
+		case e.Title != "":
+			messages = append(messages, e.Title)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Error categories used to aggregate failures in the summary.
+const (
+	categoryAuth      = "auth"
+	categoryNotFound  = "not-found"
+	categoryRateLimit = "rate-limit"
+	categoryServer    = "server"
+	categoryHTTP      = "http"
+	categoryTimeout   = "timeout"
+	categoryNetwork   = "network"
+	categoryWrite     = "write"
+	categoryDiskFull  = "disk-full"
+	categoryOther     = "other"
+)
+
+// categoryRecordTimeout is a record stopped by -max-runtime-per-record.
+const categoryRecordTimeout = "record-timeout"
+
+// classifyError maps an error to one of the summary categories.
+func classifyError(err error) string {
+	var apiErr *APIError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case isDiskFull(err):
+		return categoryDiskFull
+	case errors.Is(err, errRecordTimeout):
+		return categoryRecordTimeout
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+			return categoryAuth
+		case apiErr.StatusCode == http.StatusNotFound:
+			return categoryNotFound
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return categoryRateLimit
+		case apiErr.StatusCode >= 500:
+			return categoryServer
+		}
+		return categoryHTTP
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		// Checked before net.Error, which the wrapped syscall.Errno also satisfies.
+		return categoryWrite
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return categoryTimeout
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		// A response body cut off part way is a dropped connection.
+		return categoryNetwork
+	}
+	return categoryOther
+}
+
+// isFatal reports whether err will not go away by trying again later, such as
+// rejected credentials, an unwritable output directory, or a full disk.
+func isFatal(err error) bool {
+	if err == nil {
+		return false
+	}
+	category := classifyError(err)
+	return category == categoryAuth || category == categoryWrite || category == categoryDiskFull
+}
+
+// isDiskFull reports whether err is a write failing because the disk is full.
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// countedError is the error of a record whose causes, such as the failures of
+// its attachments, were counted in the summary errors already, so that the
+// record is not counted again.
+type countedError struct {
+	error
+}
+
+// Unwrap returns the underlying error.
+func (e countedError) Unwrap() error { return e.error }
+
+// errorCounter counts errors by category. It is safe for concurrent use.
+type errorCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// newErrorCounter creates an empty error counter.
+func newErrorCounter() *errorCounter {
+	return &errorCounter{counts: make(map[string]int)}
+}
+
+// add counts err under its category.
+func (c *errorCounter) add(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[classifyError(err)]++
+}
+
+// snapshot returns a copy of the counts.
+func (c *errorCounter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int, len(c.counts))
+	for category, n := range c.counts {
+		counts[category] = n
+	}
+	return counts
+}
+
+// formatCounts renders counts as "auth x2, timeout x5", most frequent first.
+func formatCounts(counts map[string]int) string {
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+
+	parts := make([]string, len(categories))
+	for i, category := range categories {
+		parts[i] = fmt.Sprintf("%s x%d", category, counts[category])
+	}
+	return strings.Join(parts, ", ")
+}
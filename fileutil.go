@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// logFileWarnSize is the size above which the log file is reported as growing large.
+const logFileWarnSize = 100 << 20
+
+// Default permissions for the directories and files created by a run.
+const (
+	defaultDirMode  os.FileMode = 0755
+	defaultFileMode os.FileMode = 0644
+)
+
+// parseMode parses an octal permission string such as "0640" into a FileMode.
+// Only the permission bits (at most 0777) are accepted.
+func parseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid octal mode %q", s)
+	}
+	if mode > 0777 {
+		return 0, fmt.Errorf("mode %q has bits outside 0777", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// makeDir creates dir and any missing parents, then applies mode explicitly to
+// the directories it created so the result is not narrowed by the process
+// umask. Directories that existed already, such as an -output-dir of /tmp or
+// the home directory, keep their mode.
+func makeDir(dir string, mode os.FileMode) error {
+	var created []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		created = append(created, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range created {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOutputDir verifies that dir is a directory, creating it if needed, and
+// that files can be created in it, so that a bad -output-dir fails the run up
+// front instead of failing every record. An existing directory is only probed
+// with a temporary file; its mode is left as it is.
+func checkOutputDir(dir string, mode os.FileMode) error {
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return fmt.Errorf("%s exists and is not a directory", dir)
+	case err != nil:
+		if err := makeDir(dir, mode); err != nil {
+			return fmt.Errorf("cannot create %s: %w", dir, err)
+		}
+	}
+	probe, err := os.CreateTemp(dir, ".zengrc-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// writeFile writes data to path, then applies mode explicitly so that the
+// permissions are exact regardless of the umask or a pre-existing file.
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path and
+// renames it into place, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return renameFile(tmpPath, path)
+}
+
+// rename is os.Rename, replaced by tests to simulate renames across file systems.
+var rename = os.Rename
+
+// renameFile moves src to dst. Temporary files are created in the directory of
+// their target so that this is a single atomic rename; should the rename still
+// fail because src and dst are on different file systems (EXDEV), as with a
+// mount point between them, src is copied into a temporary file next to dst,
+// which is renamed into place, and then removed.
+func renameFile(src, dst string) error {
+	err := rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	log.Printf("Warning: %s and %s are on different file systems; copying instead of renaming", src, dst)
+	return moveAcrossDevices(src, dst)
+}
+
+// moveAcrossDevices moves src to dst by copying it, keeping its permissions, so
+// that dst is replaced atomically even though src is on another file system.
+func moveAcrossDevices(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := out.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
+	}()
+
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// openLogFile opens path for appending, creating it if needed, and warns if it
+// has grown beyond logFileWarnSize so that it can be rotated.
+func openLogFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, defaultFileMode)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.Size() > logFileWarnSize {
+		log.Printf("Warning: log file %s is %d MB; consider rotating it", path, info.Size()>>20)
+	}
+	return f, nil
+}
+
+// expandPath expands the variables in an output path. ${DATE} becomes the
+// current UTC date (2006-01-02) and ${TIMESTAMP} the current UTC time
+// (20060102T150405Z); any other $VAR or ${VAR} is read from the environment,
+// and a variable that is not set is an error rather than silently empty. $$
+// yields a literal dollar sign.
+func expandPath(path string, now time.Time) (string, error) {
+	var missing []string
+	expanded := os.Expand(path, func(name string) string {
+		switch name {
+		case "$":
+			return "$"
+		case "DATE":
+			return now.UTC().Format("2006-01-02")
+		case "TIMESTAMP":
+			return now.UTC().Format("20060102T150405Z")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%s: undefined variable %s", path, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
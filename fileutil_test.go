@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMakeDirKeepsExistingMode(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Chmod(root, os.ModeSticky|0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(root, "a", "b")
+	if err := makeDir(dir, 0o750); err != nil {
+		t.Fatalf("makeDir: %v", err)
+	}
+	for _, d := range []string{filepath.Join(root, "a"), dir} {
+		info, err := os.Stat(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != 0o750 {
+			t.Errorf("mode of created %s = %o, want 750", d, got)
+		}
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode() & (os.ModePerm | os.ModeSticky); got != os.ModeSticky|0o777 {
+		t.Errorf("mode of existing %s = %v, want it unchanged", root, got)
+	}
+
+	// A directory that exists is left alone.
+	if err := makeDir(root, 0o700); err != nil {
+		t.Fatalf("makeDir: %v", err)
+	}
+	if info, err = os.Stat(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode() & (os.ModePerm | os.ModeSticky); got != os.ModeSticky|0o777 {
+		t.Errorf("mode of existing %s = %v after makeDir, want it unchanged", root, got)
+	}
+}
+
+func TestCheckOutputDir(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Chmod(root, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputDir(root, 0o700); err != nil {
+		t.Fatalf("checkOutputDir(existing): %v", err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o777 {
+		t.Errorf("mode of existing output directory = %o, want 777", got)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("checkOutputDir left %d files behind", len(entries))
+	}
+
+	created := filepath.Join(root, "out")
+	if err := checkOutputDir(created, 0o700); err != nil {
+		t.Fatalf("checkOutputDir(missing): %v", err)
+	}
+	if info, err = os.Stat(created); err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o700 {
+		t.Errorf("mode of created output directory = %o, want 700", got)
+	}
+
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputDir(file, 0o700); err == nil {
+		t.Error("checkOutputDir(file) succeeded, want an error")
+	}
+}
+
+func TestRenameFileAcrossDevices(t *testing.T) {
+	rename = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("content"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renameFile(src, dst); err != nil {
+		t.Fatalf("renameFile: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "content" {
+		t.Errorf("dst = %q, %v; want %q", data, err, "content")
+	}
+	if info, err := os.Stat(dst); err != nil {
+		t.Fatal(err)
+	} else if got := info.Mode().Perm(); got != 0o640 {
+		t.Errorf("mode of dst = %o, want 640 kept from src", got)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("src still exists: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only dst", len(entries))
+	}
+
+	// Other rename errors are returned as they are.
+	rename = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EACCES}
+	}
+	if err := renameFile(dst, src); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("renameFile = %v, want %v", err, syscall.EACCES)
+	}
+}
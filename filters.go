@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestFilter reports whether a request should be processed.
+type requestFilter func(Request) bool
+
+// selected reports whether a request passes every filter.
+func selected(request Request, filters []requestFilter) bool {
+	for _, filter := range filters {
+		if !filter(request) {
+			return false
+		}
+	}
+	return true
+}
+
+// programFilter selects requests mapped to the given program. The API does not
+// filter requests by program, so matching is done client-side on RequestMapped.
+func programFilter(programID int) requestFilter {
+	return func(request Request) bool {
+		for _, program := range request.Mapped.Programs {
+			if program.ID == programID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// typeFilter selects requests whose type is one of types, ignoring case.
+func typeFilter(types []string) requestFilter {
+	return func(request Request) bool {
+		for _, t := range types {
+			if strings.EqualFold(request.Type, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// dueDateFilter selects overdue requests (due before now), requests without a due
+// date, or both. A null due date only matches noDueDate, and an unparseable due
+// date matches neither.
+func dueDateFilter(overdue, noDueDate bool, now time.Time) requestFilter {
+	return func(request Request) bool {
+		if request.DueDate == nil || *request.DueDate == "" {
+			return noDueDate
+		}
+		if !overdue {
+			return false
+		}
+		due, err := parseDueDate(*request.DueDate)
+		if err != nil {
+			log.Printf("Warning: record %d has an unparseable due date %q", request.ID, *request.DueDate)
+			return false
+		}
+		return due.Before(now)
+	}
+}
+
+// updatedSinceFilter selects requests updated at or after since. Requests
+// without a parseable update time are selected, since they cannot be ruled out.
+func updatedSinceFilter(since time.Time) requestFilter {
+	return func(request Request) bool {
+		updated, err := time.Parse(time.RFC3339, request.UpdatedAt)
+		return err != nil || !updated.Before(since)
+	}
+}
+
+// parseDueDate parses a due date given either as a date (YYYY-MM-DD), which is
+// due until the end of that day in UTC, or as an RFC 3339 timestamp.
+func parseDueDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// findProgram walks the program list and returns the program with the given ID.
+func findProgram(ctx context.Context, client *Client, programID int) (*Program, error) {
+	var cursor string
+	for {
+		resp, err := client.GetPrograms(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for i := range resp.Data {
+			if resp.Data[i].ID == programID {
+				return &resp.Data[i], nil
+			}
+		}
+		if resp.Links.Next.Href == "" {
+			return nil, fmt.Errorf("program %d not found", programID)
+		}
+		cursor = resp.Links.Next.Href
+	}
+}
+
+// customAttrThreshold is a minimum value of a custom attribute, given with
+// -custom-attr-gte as key=number, or as key=level:scale for ordinal values,
+// where scale lists the levels from lowest to highest separated by "<".
+type customAttrThreshold struct {
+	key    string
+	number float64
+	scale  []string
+	level  int
+}
+
+// parseCustomAttrThreshold parses a -custom-attr-gte value such as Priority=3
+// or Severity=High:Low<Medium<High<Critical.
+func parseCustomAttrThreshold(s string) (customAttrThreshold, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return customAttrThreshold{}, fmt.Errorf("invalid threshold %q: want key=value", s)
+	}
+
+	threshold := customAttrThreshold{key: key}
+	level, scale, ordinal := strings.Cut(value, ":")
+	if !ordinal {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return customAttrThreshold{}, fmt.Errorf("invalid threshold %q: %q is not a number; give ordinal values as level:scale, such as High:Low<Medium<High", s, value)
+		}
+		threshold.number = number
+		return threshold, nil
+	}
+
+	threshold.level = -1
+	for i, l := range strings.Split(scale, "<") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			return customAttrThreshold{}, fmt.Errorf("invalid threshold %q: empty level in scale %q", s, scale)
+		}
+		if strings.EqualFold(l, strings.TrimSpace(level)) {
+			threshold.level = i
+		}
+		threshold.scale = append(threshold.scale, l)
+	}
+	if threshold.level < 0 {
+		return customAttrThreshold{}, fmt.Errorf("invalid threshold %q: %q is not in scale %q", s, level, scale)
+	}
+	return threshold, nil
+}
+
+// customAttrFilter selects requests whose custom attributes are at least every
+// threshold. An attribute is looked up by ID or by title, ignoring case. A
+// missing attribute, or a value that is not a number or not on the scale,
+// excludes the request.
+func customAttrFilter(thresholds []customAttrThreshold) requestFilter {
+	return func(request Request) bool {
+		for _, threshold := range thresholds {
+			attr, ok := customAttr(request, threshold.key)
+			if !ok || !threshold.met(attr.Value) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// met reports whether a custom attribute value is at least the threshold.
+func (t customAttrThreshold) met(value any) bool {
+	if t.scale != nil {
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		for i, level := range t.scale {
+			if strings.EqualFold(level, strings.TrimSpace(s)) {
+				return i >= t.level
+			}
+		}
+		return false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v >= t.number
+	case json.Number:
+		n, err := v.Float64()
+		return err == nil && n >= t.number
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return err == nil && n >= t.number
+	}
+	return false
+}
+
+// customAttr returns the custom attribute of a request with the given ID or,
+// failing that, title.
+func customAttr(request Request, key string) (CustomAttrValue, bool) {
+	if attr, ok := request.CustomAttributes[key]; ok {
+		return attr, true
+	}
+	for _, attr := range request.CustomAttributes {
+		if strings.EqualFold(attr.Title, key) {
+			return attr, true
+		}
+	}
+	return CustomAttrValue{}, false
+}
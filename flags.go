@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// stringList is a flag.Value collecting the values of a repeatable flag.
+// Each occurrence may also hold several comma-separated values.
+type stringList []string
+
+// String implements flag.Value.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value.
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// queryValues is a flag.Value collecting repeatable key=value query parameters.
+// Unlike stringList, values are kept whole, commas included.
+type queryValues url.Values
+
+// String implements flag.Value.
+func (q queryValues) String() string {
+	return url.Values(q).Encode()
+}
+
+// Set implements flag.Value.
+func (q queryValues) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid query parameter %q: expected key=value", value)
+	}
+	url.Values(q).Add(key, val)
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// globalIndexVersion is the version of the -global-index file format written by this build.
+const globalIndexVersion = 1
+
+// GlobalIndex is the persisted -global-index of downloaded documents, shared by
+// every run that points at it. Its JSON form is:
+//
+//	{"version":1,"documents":{"<document id>":{"path":"/abs/path","sha256":"...","bytes":123,"uploaded_at":"..."}}}
+type GlobalIndex struct {
+	Version   int                    `json:"version"`
+	Documents map[int]GlobalDocument `json:"documents"`
+}
+
+// GlobalDocument is the known local copy of a document.
+type GlobalDocument struct {
+	Path       string `json:"path"`
+	SHA256     string `json:"sha256"`
+	Bytes      int64  `json:"bytes"`
+	UploadedAt string `json:"uploaded_at,omitempty"`
+}
+
+// globalIndex holds the global index during a run. It is safe for concurrent use.
+type globalIndex struct {
+	mu    sync.Mutex
+	path  string
+	index GlobalIndex
+	// readOnly is set when the file on disk was written by a newer version,
+	// so that it is left untouched rather than downgraded.
+	readOnly bool
+}
+
+// loadGlobalIndex reads the global index at path. A missing file starts an
+// empty index; a corrupt file or one with an unknown version is reported with a
+// warning and also starts an empty index, so documents are downloaded again.
+func loadGlobalIndex(path string) *globalIndex {
+	g := &globalIndex{path: path, index: GlobalIndex{Version: globalIndexVersion, Documents: map[int]GlobalDocument{}}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g
+	}
+	if err != nil {
+		log.Printf("Warning: cannot read global index %s, downloading every attachment: %v", path, err)
+		return g
+	}
+
+	var index GlobalIndex
+	switch err := json.Unmarshal(data, &index); {
+	case err != nil:
+		log.Printf("Warning: global index %s is corrupt, downloading every attachment: %v", path, err)
+	case index.Version > globalIndexVersion:
+		log.Printf("Warning: global index %s has version %d, newer than the supported version %d; leaving it untouched", path, index.Version, globalIndexVersion)
+		g.readOnly = true
+	case index.Version < 1:
+		log.Printf("Warning: global index %s has no valid version, downloading every attachment", path)
+	default:
+		if index.Documents != nil {
+			g.index.Documents = index.Documents
+		}
+	}
+	return g
+}
+
+// lookup returns the known local copy of a document. A copy recorded with a
+// different upload time is not returned, since the document has changed since.
+func (g *globalIndex) lookup(attachment File) (GlobalDocument, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	doc, ok := g.index.Documents[attachment.DocumentID]
+	if !ok || (doc.UploadedAt != "" && attachment.UploadedAt != "" && doc.UploadedAt != attachment.UploadedAt) {
+		return GlobalDocument{}, false
+	}
+	return doc, true
+}
+
+// add records path as the local copy of a document.
+func (g *globalIndex) add(attachment File, path, sum string, size int64) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.index.Documents[attachment.DocumentID] = GlobalDocument{Path: abs, SHA256: sum, Bytes: size, UploadedAt: attachment.UploadedAt}
+}
+
+// forget drops a document whose recorded copy is gone or no longer matches its checksum.
+func (g *globalIndex) forget(documentID int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.index.Documents, documentID)
+}
+
+// save writes the index back to its file.
+func (g *globalIndex) save(mode os.FileMode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.readOnly {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(g.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(g.path, data, mode)
+}
+
+// reuse puts a copy of an already downloaded document at path instead of
+// downloading it again: a hard link to the known copy where possible, or a
+// byte-for-byte copy otherwise, such as across file systems. It reports false
+// when there is no usable copy, when the known copy is path itself, or when
+// path exists and overwrite is not set, leaving the attachment to the usual
+// download. It returns the checksum and size of the reused copy.
+func (g *globalIndex) reuse(attachment File, path string, overwrite bool, mode os.FileMode) (string, int64, bool, error) {
+	doc, ok := g.lookup(attachment)
+	if !ok {
+		return "", 0, false, nil
+	}
+	if abs, err := filepath.Abs(path); err != nil || abs == doc.Path {
+		return "", 0, false, nil
+	}
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return "", 0, false, nil
+		}
+	}
+
+	// The known copy may have been moved, deleted, or modified since it was indexed.
+	sum, size, err := fileSHA256(doc.Path)
+	if err != nil || sum != doc.SHA256 {
+		g.forget(attachment.DocumentID)
+		return "", 0, false, nil
+	}
+
+	if err := linkOrCopy(doc.Path, path, mode); err != nil {
+		return "", 0, false, err
+	}
+	return sum, size, true, nil
+}
+
+// linkOrCopy atomically places a hard link to src, or a copy of it, at dst.
+func linkOrCopy(src, dst string, mode os.FileMode) error {
+	dir := filepath.Dir(dst)
+	out, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmpPath := out.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
+	}()
+
+	// Link in place of the temporary file, so that dst is replaced in a single
+	// rename; copy into it instead when the file system cannot link.
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if os.Remove(tmpPath) == nil && os.Link(src, tmpPath) == nil {
+		return renameFile(tmpPath, dst)
+	}
+
+	out, err = os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(mode); err != nil {
+		_ = out.Close()
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	_, err = io.Copy(out, in)
+	_ = in.Close()
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return renameFile(tmpPath, dst)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Post-hook settings: the default bound on each run of the hook, and how long
+// its output is waited for once it has been killed, in case a child process it
+// started keeps the output open.
+const (
+	defaultPostHookTimeout = 5 * time.Minute
+	postHookWaitDelay      = 5 * time.Second
+)
+
+// runPostHook runs the post-hook command with the record directory appended as
+// its last argument, then logs the command's combined output and exit code.
+// A failing hook is logged but does not fail the record. The hook is killed
+// once it has run for timeout, if positive, or when ctx is done, so that a
+// stuck hook does not hold the worker.
+func runPostHook(ctx context.Context, command []string, recordDir string, requestID int, timeout time.Duration) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	args := append(append([]string(nil), command[1:]...), recordDir)
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.WaitDelay = postHookWaitDelay
+	output, err := cmd.CombinedOutput()
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("Post-hook for record %d was stopped: %v", requestID, context.Cause(ctx))
+		if out := strings.TrimSpace(string(output)); out != "" {
+			log.Printf("Post-hook output for record %d:\n%s", requestID, out)
+		}
+		return
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		log.Printf("Error running post-hook for record %d: %v", requestID, err)
+		return
+	}
+
+	if out := strings.TrimSpace(string(output)); out != "" {
+		log.Printf("Post-hook output for record %d:\n%s", requestID, out)
+	}
+	if exitCode != 0 {
+		log.Printf("Post-hook for record %d exited with code %d", requestID, exitCode)
+	}
+}
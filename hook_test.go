@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunPostHookTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh command")
+	}
+	start := time.Now()
+	runPostHook(context.Background(), []string{"sh", "-c", "exec sleep 30", "hook"}, t.TempDir(), 1, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("runPostHook returned after %s, want the hook killed after its timeout", elapsed)
+	}
+}
+
+func TestRunPostHookCancel(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh command")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	runPostHook(ctx, []string{"sh", "-c", "exec sleep 30", "hook"}, t.TempDir(), 1, 0)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("runPostHook returned after %s, want the hook killed once cancelled", elapsed)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readIDsFile reads request IDs separated by newlines and/or commas. Blank
+// entries are ignored; anything that is not a positive integer is an error.
+func readIDsFile(path string) ([]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for lineNo, line := range strings.Split(string(data), "\n") {
+		for _, field := range strings.Split(line, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.Atoi(field)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("line %d: invalid request ID %q", lineNo+1, field)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// eachRequestByID fetches the given requests one by one, bypassing the list
+// pagination, and calls fn for each. IDs that cannot be fetched, notably those
+// that do not exist, are reported through report and skipped. The walk stops
+// when the context is done or fn returns an error.
+func eachRequestByID(ctx context.Context, client *Client, ids []int, report func(error), fn func(Request) error) error {
+	for _, id := range ids {
+		request, err := client.GetRequestDetails(ctx, id)
+		var apiErr *APIError
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			report(fmt.Errorf("request %d not found: %w", id, err))
+			continue
+		case err != nil:
+			report(fmt.Errorf("failed to get request %d: %w", id, err))
+			continue
+		}
+		if err := fn(*request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
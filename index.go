@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IndexEntry is a single row of the request index written by -list-only.
+type IndexEntry struct {
+	ID              int    `json:"id"`
+	Code            string `json:"code"`
+	Title           string `json:"title"`
+	Status          string `json:"status"`
+	AttachmentCount *int   `json:"attachment_count,omitempty"`
+}
+
+// buildIndex lists every request that passes the filters and, if countAttachments
+// is set, counts each request's attachments using up to workers concurrent API calls.
+func buildIndex(ctx context.Context, client *Client, filters []requestFilter, countAttachments bool, workers int) ([]IndexEntry, error) {
+	var entries []IndexEntry
+	err := client.EachRequest(ctx, func(request Request) error {
+		if !selected(request, filters) {
+			return nil
+		}
+		entries = append(entries, IndexEntry{
+			ID:     request.ID,
+			Code:   request.Code,
+			Title:  request.Title,
+			Status: request.Status,
+		})
+		return nil
+	})
+	if err != nil || !countAttachments {
+		return entries, err
+	}
+
+	// Count attachments concurrently; a failed count is logged and left empty.
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(entry *IndexEntry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			attachments, err := client.GetAttachments(ctx, entry.ID)
+			if err != nil {
+				log.Printf("Error getting attachments for record %d: %v", entry.ID, err)
+				return
+			}
+			count := len(attachments)
+			entry.AttachmentCount = &count
+		}(&entries[i])
+	}
+	wg.Wait()
+	return entries, nil
+}
+
+// writeIndex writes the index to path as JSON if the path ends in ".json",
+// and as CSV otherwise.
+func writeIndex(path string, entries []IndexEntry, mode os.FileMode) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		if data, err = json.MarshalIndent(entries, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"id", "code", "title", "status", "attachment_count"})
+		for _, entry := range entries {
+			count := ""
+			if entry.AttachmentCount != nil {
+				count = strconv.Itoa(*entry.AttachmentCount)
+			}
+			_ = w.Write([]string{strconv.Itoa(entry.ID), entry.Code, entry.Title, entry.Status, count})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return writeFile(path, data, mode)
+}
+
+// runListOnly builds the request index, writes it to path, and reports the result.
+func runListOnly(ctx context.Context, client *Client, path string, countAttachments bool, workers int, opts *options) error {
+	entries, err := buildIndex(ctx, client, opts.filters, countAttachments, workers)
+	if err != nil {
+		return fmt.Errorf("failed to list requests: %w", err)
+	}
+	if err := makeDir(filepath.Dir(path), opts.dirMode); err != nil {
+		return err
+	}
+	if err := writeIndex(path, entries, opts.fileMode); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	console.Printf("Wrote index of %d requests to %s\n", len(entries), path)
+	return nil
+}
+
+// AttachmentIndexEntry is a single row of the attachment inventory written by
+// -list-attachments-only.
+type AttachmentIndexEntry struct {
+	RecordID    int    `json:"record_id"`
+	RecordTitle string `json:"record_title"`
+	DocumentID  int    `json:"document_id"`
+	Name        string `json:"name"`
+	UploadedAt  string `json:"uploaded_at"`
+}
+
+// buildAttachmentIndex lists every request that passes the filters, then lists
+// the attachments of each using up to workers concurrent API calls, keeping the
+// order of the requests. A record whose attachments cannot be listed is logged
+// and counted in the returned number of failures.
+func buildAttachmentIndex(ctx context.Context, client *Client, filters []requestFilter, workers int) ([]AttachmentIndexEntry, int, error) {
+	var requests []Request
+	err := client.EachRequest(ctx, func(request Request) error {
+		if selected(request, filters) {
+			requests = append(requests, request)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	files := make([][]File, len(requests))
+	var failed int
+	var mu sync.Mutex
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			attachments, err := client.GetAttachmentsFor(ctx, &requests[i])
+			if err != nil {
+				log.Printf("Error getting attachments for record %d: %v", requests[i].ID, err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+			files[i] = attachments
+		}(i)
+	}
+	wg.Wait()
+
+	var entries []AttachmentIndexEntry
+	for i, request := range requests {
+		for _, file := range files[i] {
+			entries = append(entries, AttachmentIndexEntry{
+				RecordID:    request.ID,
+				RecordTitle: request.Title,
+				DocumentID:  file.DocumentID,
+				Name:        file.Name,
+				UploadedAt:  file.UploadedAt,
+			})
+		}
+	}
+	return entries, failed, nil
+}
+
+// writeAttachmentIndex writes the attachment inventory to path as JSON if the
+// path ends in ".json", and as CSV otherwise.
+func writeAttachmentIndex(path string, entries []AttachmentIndexEntry, mode os.FileMode) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		if data, err = json.MarshalIndent(entries, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"record_id", "record_title", "document_id", "name", "uploaded_at"})
+		for _, entry := range entries {
+			_ = w.Write([]string{strconv.Itoa(entry.RecordID), entry.RecordTitle, strconv.Itoa(entry.DocumentID), entry.Name, entry.UploadedAt})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return writeFile(path, data, mode)
+}
+
+// runListAttachments builds the attachment inventory, writes it to path, and
+// reports the result. Records whose attachments could not be listed make it
+// return an error once the inventory of the others is written.
+func runListAttachments(ctx context.Context, client *Client, path string, workers int, opts *options) error {
+	entries, failed, err := buildAttachmentIndex(ctx, client, opts.filters, workers)
+	if err != nil {
+		return fmt.Errorf("failed to list requests: %w", err)
+	}
+	if err := makeDir(filepath.Dir(path), opts.dirMode); err != nil {
+		return err
+	}
+	if err := writeAttachmentIndex(path, entries, opts.fileMode); err != nil {
+		return fmt.Errorf("failed to write attachment inventory: %w", err)
+	}
+	console.Printf("Wrote inventory of %d attachments to %s\n", len(entries), path)
+	if failed > 0 {
+		return fmt.Errorf("the attachments of %d records could not be listed and are missing from the inventory", failed)
+	}
+	return nil
+}
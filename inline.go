@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// inlineDirName is the subdirectory of a record directory that holds the files
+// linked from the text fields of the record, saved by -fetch-inline.
+const inlineDirName = "inline"
+
+// Statuses of the files linked from the text fields of a record.
+const (
+	inlineDownloaded = "downloaded"
+	inlineExisting   = "existing"
+	inlineExternal   = "external"
+	inlineFailed     = "failed"
+)
+
+// inlineLinkPatterns match the link targets of the HTML and Markdown text
+// fields: src and href attributes, and Markdown links and images.
+var inlineLinkPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:src|href)\s*=\s*["']([^"']+)["']`),
+	regexp.MustCompile(`\]\(\s*<?([^\s()<>]+)>?(?:\s+"[^"]*")?\s*\)`),
+}
+
+// InlineResult captures the outcome of a file linked from the text fields of a
+// record. Links outside the API are listed as external but never followed, so
+// that the API credentials are not sent to another host.
+type InlineResult struct {
+	Source string `json:"source"`
+	Path   string `json:"path,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// inlineLinks returns the distinct link targets of the description, notes, and
+// test plan of a request, in order of appearance. Anchors within the page and
+// data, mailto, and javascript URLs are left out.
+func inlineLinks(request *Request) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, text := range []string{request.GetDescription(), request.GetNotes(), request.GetTest()} {
+		for _, pattern := range inlineLinkPatterns {
+			for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+				link := strings.TrimSpace(strings.ReplaceAll(match[1], "&amp;", "&"))
+				if link == "" || seen[link] || strings.HasPrefix(link, "#") {
+					continue
+				}
+				if u, err := url.Parse(link); err == nil {
+					switch strings.ToLower(u.Scheme) {
+					case "data", "mailto", "javascript":
+						continue
+					}
+				}
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+// inlineName returns the file name under which a linked file is saved: the last
+// element of its path, or "file" if it has none, numbered if another linked
+// file of the record already uses it.
+func inlineName(names *nameRegistry, apiPath string) string {
+	name := "file"
+	if u, err := url.Parse(apiPath); err == nil {
+		if base := path.Base(u.Path); base != "/" && base != "." && !strings.HasPrefix(base, ".") {
+			name = base
+		}
+	}
+	if names.claim(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		if numbered := fmt.Sprintf("%s_%d%s", base, n, ext); names.claim(numbered) {
+			return numbered
+		}
+	}
+}
+
+// fetchInline downloads the files linked from the text fields of a request that
+// the API serves into the inline subdirectory of dir, relDir being dir relative
+// to the output directory. It returns the outcome of every link and the number
+// of links that could not be downloaded.
+func fetchInline(ctx context.Context, client *Client, request *Request, dir, relDir string, opts *options) ([]InlineResult, int, error) {
+	links := inlineLinks(request)
+	if len(links) == 0 {
+		return nil, 0, nil
+	}
+	dir, relDir = filepath.Join(dir, inlineDirName), filepath.Join(relDir, inlineDirName)
+	if err := makeDir(dir, opts.dirMode); err != nil {
+		return nil, 0, fmt.Errorf("error creating directory for record %d: %w", request.ID, err)
+	}
+
+	var results []InlineResult
+	failed := 0
+	names := newNameRegistry()
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return results, failed, err
+		}
+		entry := InlineResult{Source: link}
+		apiPath, ok := client.linkPath(link)
+		if !ok {
+			entry.Status = inlineExternal
+			results = append(results, entry)
+			continue
+		}
+
+		name := inlineName(names, apiPath)
+		target := filepath.Join(dir, name)
+		entry.Path = filepath.ToSlash(filepath.Join(relDir, name))
+		console.Printf("Downloading linked file: %s\n", link)
+
+		err := opts.disk.do(ctx, target, func() error {
+			return client.downloadLinkToFile(ctx, apiPath, target, opts.overwrite)
+		})
+		switch {
+		case err == nil:
+			entry.Status = inlineDownloaded
+			entry.SHA256, entry.Bytes, _ = fileSHA256(target)
+		case errors.Is(err, ErrAttachmentExists):
+			entry.Status = inlineExisting
+		case isDiskFull(err):
+			entry.Status, entry.Error = inlineFailed, err.Error()
+			return append(results, entry), failed + 1, err
+		default:
+			log.Printf("Error downloading linked file %s for record %d: %v", link, request.ID, err)
+			opts.errors.add(err)
+			entry.Status, entry.Error = inlineFailed, err.Error()
+			failed++
+		}
+		results = append(results, entry)
+	}
+	return results, failed, nil
+}
+
+// downloadLinkToFile downloads the file at an API path to filePath through a
+// temporary file, as DownloadAttachment does with attachments, returning
+// ErrAttachmentExists if the file exists and overwrite is false.
+func (c *Client) downloadLinkToFile(ctx context.Context, apiPath, filePath string, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Stat(filePath); err == nil {
+			return ErrAttachmentExists
+		}
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmpPath := out.Name()
+	defer func() {
+		_ = os.Remove(tmpPath) // No-op once the file has been renamed into place.
+	}()
+
+	if err := out.Chmod(c.fileMode); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := c.downloadLink(ctx, apiPath, out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return renameFile(tmpPath, filePath)
+}
+
+// downloadLink streams the file at an API path into w.
+func (c *Client) downloadLink(ctx context.Context, apiPath string, w io.Writer) error {
+	req, err := c.newRequest(withFileRequest(ctx), "GET", apiPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
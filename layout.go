@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// groupByStatus groups record directories under a directory named after their status.
+const groupByStatus = "status"
+
+// noStatusDir is the status directory of records without a usable status.
+const noStatusDir = "no_status"
+
+// recordDirName returns the name of the directory holding a record's files.
+func recordDirName(requestID int) string {
+	return fmt.Sprintf("record_%d", requestID)
+}
+
+// recordPath returns the directory of a record relative to the output directory:
+// record_<id>, nested under its status directory when grouping by status.
+func recordPath(opts *options, request Request) string {
+	if opts.groupRecords == groupByStatus {
+		return filepath.Join(statusDirName(request.Status), recordDirName(request.ID))
+	}
+	return recordDirName(request.ID)
+}
+
+// statusDirName normalizes a status into a directory name: lower-cased, with
+// runs of spaces and separators turned into a single underscore and anything
+// but letters, digits, hyphens, and underscores dropped. "In Progress" and
+// "in-progress " thus map to "in_progress" and "in-progress".
+func statusDirName(status string) string {
+	var b strings.Builder
+	pendingSep := false
+	for _, r := range strings.ToLower(strings.TrimSpace(status)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-':
+			if pendingSep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pendingSep = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '_' || r == '/' || r == '\\' || r == '.':
+			pendingSep = true
+		}
+	}
+	if b.Len() == 0 {
+		return noStatusDir
+	}
+	return b.String()
+}
+
+// removeStaleCopies deletes the directories of a record left under other status
+// directories, typically because its status changed since an earlier run.
+func removeStaleCopies(outputDir string, requestID int, keep string) {
+	matches, err := filepath.Glob(filepath.Join(outputDir, "*", recordDirName(requestID)))
+	if err != nil {
+		return
+	}
+	for _, dir := range matches {
+		if dir == filepath.Join(outputDir, keep) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Error removing stale copy %s of record %d: %v", dir, requestID, err)
+			continue
+		}
+		log.Printf("Removed stale copy %s of record %d after a status change", dir, requestID)
+	}
+}
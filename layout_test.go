@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestStatusDirName(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"Completed", "completed"},
+		{"In Progress", "in_progress"},
+		{"  In   Progress  ", "in_progress"},
+		{"in-progress ", "in-progress"},
+		{"Ready_for_Review", "ready_for_review"},
+		{"Needs Review/Rework", "needs_review_rework"},
+		{"../../etc", "etc"},
+		{`Draft\.Pending`, "draft_pending"},
+		{"Approved!", "approved"},
+		{"Überprüft", "überprüft"},
+		{"", noStatusDir},
+		{"   ", noStatusDir},
+		{"!!!", noStatusDir},
+		{"..", noStatusDir},
+	}
+	for _, tt := range tests {
+		if got := statusDirName(tt.status); got != tt.want {
+			t.Errorf("statusDirName(%q) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// attachmentsRel is the link relation of the attachments of an object.
+const attachmentsRel = "attachments"
+
+// Link is a link relation of an object.
+type Link struct {
+	Href string `json:"href"`
+}
+
+// DetailsLinks holds the link relations of an object, such as "self", keyed by
+// relation name, so that relations this client does not use are preserved in
+// the saved metadata.
+type DetailsLinks map[string]Link
+
+// UnmarshalJSON implements json.Unmarshaler. A relation that is not an object
+// with an href, such as a list of links, is skipped rather than failing the
+// whole object.
+func (l *DetailsLinks) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	links := make(DetailsLinks, len(raw))
+	for rel, value := range raw {
+		var link Link
+		if json.Unmarshal(value, &link) == nil {
+			links[rel] = link
+		}
+	}
+	*l = links
+	return nil
+}
+
+// Href returns the target of a link relation, or "" if there is none.
+func (l DetailsLinks) Href(rel string) string {
+	return l[rel].Href
+}
+
+// linkPath returns the API path of a link target, which the API gives either
+// as a path or as an absolute URL. It reports false for a URL outside the API,
+// which is never followed.
+func (c *Client) linkPath(href string) (string, bool) {
+	target, err := url.Parse(href)
+	if err != nil || href == "" {
+		return "", false
+	}
+	if !target.IsAbs() {
+		return href, strings.HasPrefix(href, "/")
+	}
+	api, err := url.Parse(c.apiURL)
+	if err != nil || target.Scheme != api.Scheme || target.Host != api.Host {
+		return "", false
+	}
+	return target.RequestURI(), true
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// WithStreamingList makes EachRequest decode each request list page one request
+// at a time, handing every request to its callback as soon as it is decoded,
+// instead of decoding the whole page into memory first. This bounds the memory
+// used by very large pages.
+//
+// Since the page is read as fast as the callback returns, a slow consumer may
+// make reading a page outlast the request timeout. A page that fails part way
+// is fetched again like any other, and the requests already handed over are
+// skipped, assuming the page has not changed in the meantime.
+func WithStreamingList() Option {
+	return func(c *Client) {
+		c.streamList = true
+	}
+}
+
+// callbackError wraps an error returned by the callback of EachRequest, so that
+// it is told apart from a failure to fetch the page and is never retried.
+type callbackError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e *callbackError) Error() string { return e.err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *callbackError) Unwrap() error { return e.err }
+
+// walkRequestsPage calls fn for each request of the request list page at cursor
+// and returns the cursor of the next page, empty after the last page, as given
+// by the pagination strategy. Errors from fn are returned as *callbackError.
+func (c *Client) walkRequestsPage(ctx context.Context, cursor string, fn func(Request) error) (string, error) {
+	if c.streamList {
+		next, n, err := c.streamRequestsPage(ctx, cursor, fn)
+		if err != nil {
+			return "", err
+		}
+		return c.nextCursor(cursor, next, n)
+	}
+
+	resp, err := c.getRequestsPage(ctx, cursor)
+	if err != nil {
+		return "", err
+	}
+	for _, request := range resp.Data {
+		if err := fn(request); err != nil {
+			return "", &callbackError{err: err}
+		}
+	}
+	return c.nextCursor(cursor, resp.Links.Next.Href, len(resp.Data))
+}
+
+// streamRequestsPage is the streaming counterpart of getRequestsPage: it fetches
+// the page at cursor again with backoff while it fails with a transient error,
+// resuming after the requests already handed to fn. It also returns the number
+// of requests on the page.
+func (c *Client) streamRequestsPage(ctx context.Context, cursor string, fn func(Request) error) (string, int, error) {
+	handed := 0
+	for attempt := 0; ; attempt++ {
+		next, n, err := c.streamRequests(ctx, cursor, handed, fn)
+		handed = max(handed, n)
+		if _, ok := err.(*callbackError); ok {
+			return "", handed, err
+		}
+		if err == nil || attempt >= c.pageRetries || ctx.Err() != nil || !retryablePageError(err) {
+			return next, handed, err
+		}
+		delay := backoff(c.pageBaseDelay, attempt)
+		log.Printf("Reading request list page %s failed after %d requests, retrying in %s (%d/%d): %v",
+			c.pageLabel(cursor), handed, delay.Round(time.Millisecond), attempt+1, c.pageRetries, err)
+		if err := c.sleep(ctx, delay); err != nil {
+			return "", handed, err
+		}
+	}
+}
+
+// streamRequests fetches the request list page at cursor and decodes its data
+// array one request at a time, calling fn for each request after the first skip
+// ones. It returns the cursor of the next page and the number of requests of the
+// page decoded so far, skipped ones included.
+func (c *Client) streamRequests(ctx context.Context, cursor string, skip int, fn func(Request) error) (string, int, error) {
+	path := c.requestsListPath()
+	if cursor != "" {
+		path = cursor // The cursor from the API response is a full path.
+	}
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	if err := checkResponse(resp); err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return "", 0, nil
+	}
+
+	// Walk the top-level object, decoding the requests of "data" one by one and
+	// the other members whole. With schema validation, each request is checked
+	// as it is decoded, and the rest of the page, its data left empty, once it
+	// has been read.
+	var check func(item []byte) error
+	if c.schema != nil {
+		check = func(item []byte) error {
+			return c.schema.checkAt(schemaRequest, schemaRequestList+".data[]", req.URL.Path, item)
+		}
+	}
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err == io.EOF {
+		return "", 0, nil // An empty body is an empty page, as with do.
+	} else if err != nil {
+		return "", 0, err
+	}
+	var next string
+	n := 0
+	page := make(map[string]json.RawMessage)
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", n, err
+		}
+		if key == "data" {
+			page["data"] = json.RawMessage("[]")
+			if n, err = decodeRequests(dec, skip, check, fn); err != nil {
+				return "", n, err
+			}
+			continue
+		}
+		var member json.RawMessage
+		if err := dec.Decode(&member); err != nil {
+			return "", n, err
+		}
+		if name, ok := key.(string); ok {
+			page[name] = member
+		}
+		if key == "links" {
+			var links struct {
+				Next struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			}
+			if err := json.Unmarshal(member, &links); err != nil {
+				return "", n, err
+			}
+			next = links.Next.Href
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return "", n, err
+	}
+	if c.schema != nil {
+		body, err := json.Marshal(page)
+		if err != nil {
+			return "", n, err
+		}
+		if err := c.schema.check(schemaRequestList, req.URL.Path, body); err != nil {
+			return "", n, err
+		}
+	}
+	return next, n, nil
+}
+
+// decodeRequests decodes a JSON array of requests, or null, calling fn for each
+// request after the first skip ones. Each request handed to fn is first passed
+// to check, if not nil, as it was read. It returns the number of requests
+// decoded.
+func decodeRequests(dec *json.Decoder, skip int, check func(item []byte) error, fn func(Request) error) (int, error) {
+	token, err := dec.Token()
+	if err != nil || token == nil {
+		return 0, err
+	}
+	if token != json.Delim('[') {
+		return 0, fmt.Errorf("request list data: expected an array, got %v", token)
+	}
+	n := 0
+	for dec.More() {
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return n, err
+		}
+		n++
+		if n <= skip {
+			continue
+		}
+		if check != nil {
+			if err := check(item); err != nil {
+				return n, err
+			}
+		}
+		var request Request
+		if err := json.Unmarshal(item, &request); err != nil {
+			return n, err
+		}
+		if err := fn(request); err != nil {
+			return n, &callbackError{err: err}
+		}
+	}
+	return n, expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token of dec, which must be the delimiter want.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("request list: expected %v, got %v", want, token)
+	}
+	return nil
+}
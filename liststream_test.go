@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// streamedPage is a request list page whose second request lacks its title and
+// has a field that the schema does not know.
+const streamedPage = `{"data": [
+	{"id": 1, "title": "First"},
+	{"id": 2, "surprise": true}
+], "links": {"next": {"href": ""}}, "meta": "unexpected"}`
+
+func TestStreamingListSchemaValidation(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, streamedPage)
+	})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	client := newTestClient(t, handler, WithStreamingList(), WithSchemaValidation(false))
+	var ids []int
+	if err := client.EachRequest(context.Background(), func(r Request) error {
+		ids = append(ids, r.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachRequest: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("EachRequest handed %v, want both requests", ids)
+	}
+	for _, want := range []string{
+		"request_list.data[].title is missing",
+		"request_list.data[].surprise is not an expected field",
+		"request_list.meta is string, expected object",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log does not report %q:\n%s", want, logs.String())
+		}
+	}
+
+	// Strictly, the first mismatching request fails the page.
+	strict := newTestClient(t, handler, WithStreamingList(), WithSchemaValidation(true), WithPageRetries(0, 0))
+	ids = nil
+	err := strict.EachRequest(context.Background(), func(r Request) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "title is missing") {
+		t.Errorf("strict EachRequest = %v, want a schema error", err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("strict EachRequest handed %v, want only the first request", ids)
+	}
+}
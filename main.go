@@ -1,58 +1,1017 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var version = "dev"
 
+// exitDeadline is the exit code used when the run is stopped by -deadline.
+const exitDeadline = 3
+
+// exitErrorRate is the exit code used when more records failed than -max-error-rate allows.
+const exitErrorRate = 4
+
+// options holds the runtime configuration shared by the workers.
+type options struct {
+	outputDir  string
+	overwrite  bool
+	checksums  map[attachmentKey]AttachmentResult
+	latestOnly bool
+	noMetadata bool
+	redact     *redactor
+	fileMode   os.FileMode
+	dirMode    os.FileMode
+	filters    []requestFilter
+	postHook   []string
+	people     *peopleIndex
+	reviews    *reviewReport
+	errors     *errorCounter
+	state      *stateStore
+	global     *globalIndex
+	disk       *diskGuard
+	// waitOnDiskFull is how long a write that failed on a full disk waits
+	// before it is tried again; zero stops the run instead.
+	waitOnDiskFull time.Duration
+
+	// incremental skips records unchanged since the state was saved,
+	// onlyNewAttachments skips attachments older than the state's watermark,
+	// and sinceLastRun records the start of every fully successful pass in the
+	// state, as the -since-last-run filter of the next run.
+	incremental        bool
+	onlyNewAttachments bool
+	sinceLastRun       bool
+
+	// recordRetries is how many more times a record failing with a transient
+	// error is processed, after a backoff from recordBaseDelay.
+	recordRetries   int
+	recordBaseDelay time.Duration
+
+	// recordTimeout bounds the processing of each record, retries included;
+	// zero means no limit.
+	recordTimeout time.Duration
+
+	// postHookTimeout bounds each run of the post-hook; zero means no limit.
+	postHookTimeout time.Duration
+
+	// compress stores the attachments gzipped, except for types that are
+	// compressed already.
+	compress bool
+
+	// missingAttachment is the -missing-attachment policy for attachments
+	// that are listed but no longer found when downloaded.
+	missingAttachment string
+
+	// fetchInline downloads the files linked from the description, notes, and
+	// test plan of each record into its inline subdirectory.
+	fetchInline bool
+
+	// includeDocuments and excludeDocuments select attachments by document ID.
+	includeDocuments map[int]bool
+	excludeDocuments map[int]bool
+
+	// attachmentsSince drops the attachments uploaded before it, and those
+	// without a parseable upload time if skipUndated is set.
+	attachmentsSince time.Time
+	skipUndated      bool
+
+	// metadataDir and attachmentsDir are the roots of the record trees holding
+	// the metadata and the attachments; both are outputDir by default.
+	metadataDir    string
+	attachmentsDir string
+
+	flatten          bool
+	flattenNaming    string
+	groupAttachments string
+	flatNames        *nameRegistry
+	groupRecords     string
+	order            func(a, b Request) int
+
+	stdout bool
+
+	workers            int
+	ids                []int
+	maxPages           int
+	startCursor        string
+	maxAttachments     int
+	completed          map[int]RecordResult
+	targzPath          string
+	bundlePath         string
+	sqlitePath         string
+	requireAttachments bool
+	reportHTML         string
+}
+
 // main is the entry point of the application. It parses command-line flags,
 // sets up a worker pool for concurrent processing, fetches all records from the
 // ZenGRC API, and distributes them to the workers for processing.
 func main() {
+	// Route log output through the console printer so it never interleaves with worker output.
+	log.SetOutput(console.Writer(os.Stderr))
+
 	// Define and parse command-line flags for configuration.
 	apiURL := flag.String("api-url", "", "The URL of your ZenGRC API instance (e.g., https://acme.api.zengrc.com).")
-	token := flag.String("token", "", "Your ZenGRC API authentication token (key_id:key_secret).")
+	token := flag.String("token", "", "Your ZenGRC API authentication token (key_id:key_secret). Defaults to the ZENGRC_TOKEN environment variable.")
+	netrcFile := flag.String("netrc-file", "", "Read the token from this netrc file when neither -token nor ZENGRC_TOKEN is set: the login and password of the machine entry of the -api-url host, or of the default entry, are the key ID and secret.")
 	outputDir := flag.String("output-dir", "./zengrc_attachments", "The directory where the attachments and metadata will be saved.")
-	numWorkers := flag.Int("workers", 5, "The number of concurrent workers to use.")
+	metadataDir := flag.String("metadata-dir", "", "Save the metadata of each record in this directory tree instead of -output-dir.")
+	attachmentsDir := flag.String("attachments-dir", "", "Save the attachments of each record in this directory tree instead of -output-dir.")
+	numWorkers := flag.Int("workers", 5, "The number of concurrent workers to use; 0 picks a count from the number of CPUs.")
+	skipUnchanged := flag.Bool("skip-unchanged", false, "With -overwrite, keep local attachments whose checksum and upload time match the previous run's manifest instead of downloading them again.")
 	overwrite := flag.Bool("overwrite", false, "Overwrite existing files.")
-	showVersion := flag.Bool("version", false, "Print the application version and exit.")
+	noMetadata := flag.Bool("no-metadata", false, "Download only the attachments, without saving metadata.json or fetching the request details.")
+	latestOnly := flag.Bool("latest-only", false, "Download only the most recently uploaded version of each attachment name.")
+	attachmentsSince := flag.String("attachments-since", "", "Only download attachments uploaded on or after this date (YYYY-MM-DD, midnight UTC, or an RFC 3339 timestamp).")
+	undatedAttachments := flag.String("undated-attachments", undatedDownload, "With -attachments-since, what to do with attachments whose upload time cannot be parsed: download or skip.")
+	maxAttachments := flag.Int("max-attachments", 0, "Download at most this many attachments per record, the most recently uploaded first, for sampling (0 downloads all).")
+	resumeRun := flag.String("resume-run", "", "Path to a manifest from a previous run; records it marks as complete are skipped.")
+	fileMode := flag.String("file-mode", "0644", "The octal permissions applied to saved files.")
+	dirMode := flag.String("dir-mode", "0755", "The octal permissions applied to created directories.")
+	sqlitePath := flag.String("sqlite", "", "Also write the requests and attachments of the run into tables of a SQLite database at this path as records are processed, for SQL queries over the evidence inventory. Requires a build with -tags sqlite.")
+	bundlePath := flag.String("bundle", "", "Also write the metadata and base64-encoded attachments of every record into a single JSON file at this path.")
+	targzPath := flag.String("targz", "", "Also write the whole output as a gzip-compressed tar archive to this path.")
+	listOnly := flag.Bool("list-only", false, "Write an index of all requests and exit without downloading anything.")
+	auditLocal := flag.String("audit-local", "", "Compare the record directories of this existing output directory with the attachments the API currently lists, report the local files that no longer exist remotely and the remote files missing locally, and exit without downloading anything.")
+	listAttachmentsOnly := flag.Bool("list-attachments-only", false, "Like -list-only, but write an inventory of the attachments of every request, without downloading them or fetching the request details.")
+	indexFile := flag.String("index-file", "", "The path of the index written by -list-only; a .json extension selects JSON, otherwise CSV (default <output-dir>/index.csv, or <output-dir>/attachments.csv with -list-attachments-only).")
+	countAttachments := flag.Bool("count-attachments", false, "With -list-only, also count the attachments of each request.")
+	programID := flag.Int("program-id", 0, "Only export requests mapped to the program with this ID.")
+	requireAttachments := flag.Bool("require-attachments", false, "Count records without any attachments as issues in the summary.")
+	postHook := flag.String("post-hook", "", "A command run after each record is processed, with the record directory appended as its last argument.")
+	postHookTimeout := flag.Duration("post-hook-timeout", defaultPostHookTimeout, "Kill a -post-hook command that is still running after this duration (0 means no limit).")
+	maxRetries := flag.Int("max-retries", defaultMaxRetries, "The number of times a request failing with a network error, 429, or 5xx is retried.")
+	timeoutPerFile := flag.Duration("timeout-per-file", 0, "Bound each attachment download attempt by this duration instead of the 60s request timeout, resuming timed-out downloads (0 keeps the request timeout).")
+	maxTotalRetries := flag.Int("max-total-retries", 0, "The maximum number of retries across the whole run, all tenants of -all-tenants and all -follow passes included, before failing fast (0 means unlimited).")
+	breakerThreshold := flag.Int("breaker-threshold", defaultBreakerThreshold, "Pause all requests after this many consecutive failures (0 disables the circuit breaker).")
+	breakerCooldown := flag.Duration("breaker-cooldown", defaultBreakerCooldown, "How long the circuit breaker pauses requests before probing the API again.")
+	noDetailsCache := flag.Bool("no-details-cache", false, "Always fetch fresh request details instead of reusing details fetched earlier in the run.")
+	trace := flag.Bool("trace", false, "Log DNS, connect, TLS handshake, and time-to-first-byte latencies for every request.")
+	maxErrorRate := flag.Float64("max-error-rate", 1, "Exit with code 4 when the share of failed records, from 0 to 1, is above this rate, even if other records succeeded (1 never fails).")
+	deadline := flag.Duration("deadline", 0, "Stop the whole run after this duration, cancelling in-flight downloads (0 means no deadline).")
+	flatten := flag.Bool("flatten", false, "Save all attachments directly in the output directory instead of per-record folders.")
+	flattenNaming := flag.String("flatten-naming", flattenPrefixed, "The naming scheme of flattened attachments: prefixed (<id>__<name>) or original (<name>).")
+	order := flag.String("order", "", "Sort requests before processing: id-asc, id-desc, due-date, or created. Buffers the whole request list in memory.")
+	groupBy := flag.String("group-by", "", "Group record directories; \"status\" saves them under a directory named after the request status.")
+	groupAttachmentsBy := flag.String("group-attachments-by", "", "Group attachments into subdirectories; \"ext\" groups them by file extension.")
+	overdue := flag.Bool("overdue", false, "Only export requests whose due date has passed.")
+	noDueDate := flag.Bool("no-due-date", false, "Only export requests without a due date (combined with -overdue, export both).")
+	idsFile := flag.String("ids-file", "", "Only export the request IDs listed in this file (separated by newlines or commas), without listing all requests.")
+	waitOnDiskFull := flag.Duration("wait-on-disk-full", 0, "When a write fails because the disk is full, wait this long and try again, instead of stopping the run (0 stops).")
+	maxRuntimePerRecord := flag.Duration("max-runtime-per-record", 0, "Stop processing a record after this duration, retries included, cancelling its downloads and recording it as failed with a record timeout, so that a pathological record does not hold a worker (0 means no limit).")
+	recordRetries := flag.Int("record-retries", defaultRecordRetries, "The number of times a record that fails with a rate limiting, server, timeout, or network error, after -max-retries, is processed again from the start, with a longer backoff, before it is recorded as failed. Permanent errors such as 403 or 404 are not retried.")
+	pageRetries := flag.Int("page-retries", defaultPageRetries, "The number of times a request list page that still fails after -max-retries is fetched again, with a longer backoff, before the listing stops.")
+	pagination := flag.String("pagination", paginationLinks, "How to move from one request list page to the next: links (follow the API's links.next), page (increment ?page=), or offset (advance ?offset= by the requests received).")
+	validateSchema := flag.Bool("validate-schema", false, "Check the request list, request details, and attachment list responses against the embedded API schema, and warn once about each field that does not match.")
+	schemaStrict := flag.Bool("schema-strict", false, "With -validate-schema, fail the calls whose response does not match the schema instead of only warning.")
+	streamList := flag.Bool("stream-list", false, "Decode request list pages one request at a time, handing each to the workers as soon as it is read, to bound memory with very large pages.")
+	skipBadPages := flag.Bool("skip-bad-pages", false, "Skip a request list page that still fails after all retries instead of stopping the listing.")
+	stdoutMode := flag.Bool("stdout", false, "Stream the metadata of each request to standard output as NDJSON, without writing any file or downloading attachments.")
+	confirm := flag.Bool("confirm", false, "Estimate the number of records and attachments first and ask for confirmation before downloading.")
+	checkSpace := flag.Bool("check-disk-space", false, "Estimate the size of the attachments with HEAD requests first, and stop if it exceeds the free space of the output directory.")
+	assumeYes := flag.Bool("yes", false, "With -confirm, proceed without prompting.")
+	var redactFields stringList
+	flag.Var(&redactFields, "redact-fields", "Blank out these metadata fields before saving or streaming them: a field name of the request such as description at any depth, or a dotted path such as assignees.name (repeatable or comma-separated). Only the fields of the saved metadata.json can be redacted.")
+	var fields stringList
+	flag.Var(&fields, "fields", "Request only these fields in request list calls (repeatable or comma-separated); the fields the enabled features need are always added.")
+	query := queryValues{}
+	flag.Var(query, "query", "Add a key=value query parameter, URL-encoded but otherwise sent as given, to the request list call, for server-side filters the application does not wrap (repeatable).")
+	var customAttrMins stringList
+	flag.Var(&customAttrMins, "custom-attr-gte", "Only export requests whose custom attribute, by ID or title, is at least a value: key=number, or key=level:scale for ordinal values such as Severity=High:Low<Medium<High (repeatable or comma-separated).")
+	missingAttachment := flag.String("missing-attachment", missingFail, "What to do with an attachment that is listed but no longer found (404) when downloaded: skip it silently, warn, or fail the record. It is recorded as missing in the manifest either way.")
+	compress := flag.Bool("compress", false, "Store each attachment gzipped, with a .gz suffix, unless its type is compressed already (archives, images, audio and video, PDF, and Office documents). The manifest keeps the size and checksum of the original, and the unchanged-file check decompresses to compare them.")
+	fetchInline := flag.Bool("fetch-inline", false, "Also download the images and documents linked from the description, notes, and test plan of each record, when the API serves them, into an inline subdirectory of the record. Links to other hosts are listed in the manifest but not followed.")
+	var includeDocuments, excludeDocuments stringList
+	flag.Var(&includeDocuments, "document-id-include", "Only download the attachments with these document IDs, across all records (repeatable or comma-separated).")
+	flag.Var(&excludeDocuments, "document-id-exclude", "Never download the attachments with these document IDs, across all records (repeatable or comma-separated).")
+	var types stringList
+	flag.Var(&types, "type", "Only export requests of this type, ignoring case (repeatable or comma-separated).")
+	incremental := flag.Bool("incremental", false, "Skip requests that were fully synced by a previous run and have not been updated since.")
+	startCursor := flag.String("start-cursor", "", "Start the request list at this page, a path or URL as given by the links.next of a previous page, instead of the first page.")
+	maxPages := flag.Int("max-pages", 0, "With -incremental, list at most this many request list pages, starting where the previous run stopped, and save the next page in the state file (0 lists all pages).")
+	sinceLastRun := flag.Bool("since-last-run", false, "Only export requests updated since the start of the last fully successful run, as remembered in the state file.")
+	onlyNewAttachments := flag.Bool("only-new-attachments", false, "Only download attachments uploaded after the most recent one seen for the record by a previous run, as remembered in the state file.")
+	follow := flag.Bool("follow", false, "After each pass, wait -poll-interval and sync again incrementally, until interrupted.")
+	pollInterval := flag.Duration("poll-interval", 5*time.Minute, "The time to wait between passes with -follow.")
+	allTenants := flag.Bool("all-tenants", false, "Export every tenant listed in -tenants-config instead of a single -api-url.")
+	tenantsConfigPath := flag.String("tenants-config", "", "A JSON file listing the tenants exported by -all-tenants.")
+	tenantConcurrency := flag.Int("tenant-concurrency", 1, "The number of tenants exported at the same time with -all-tenants.")
+	summaryJSON := flag.String("summary-json", "", "Write the end-of-run summary as JSON to this file.")
+	webhookURL := flag.String("webhook-url", "", "POST the end-of-run summary as JSON to this URL, as a run.completed or run.failed event, after the run and after each -follow pass. Failed deliveries are retried twice.")
+	notifyURL := flag.String("notify", "", "Post a readable summary of the run, after the run and after each -follow pass, to a Slack or Microsoft Teams incoming webhook, given with the slack:// or teams:// scheme in place of https://.")
+	webhookSecret := flag.String("webhook-secret", "", "Sign the -webhook-url payload with an HMAC-SHA256 keyed by this shared secret, sent in the X-Zengrc-Signature header as sha256=<hex>.")
+	reportHTML := flag.String("report-html", "", "Write a self-contained HTML report of the run, with every record, its attachment counts, and the failures, to this file.")
+	globalIndexPath := flag.String("global-index", "", "A JSON index of downloaded documents shared across runs; documents already in it are linked or copied from their known location instead of downloaded again.")
+	stateFile := flag.String("state-file", "", "The path of the incremental sync state (default <output-dir>/state.json).")
+	logFile := flag.String("log-file", "", "Also append log messages and errors to this file.")
+	mode := flag.String("mode", modeRequests, "The objects to export with their evidence: requests or assessments.")
+	apiPrefix := flag.String("api-prefix", defaultAPIPrefix, "The path prefix of all API endpoints, for another API version or a gateway.")
+	dialTimeout := flag.Duration("dial-timeout", defaultDialTimeout, "The timeout for opening a connection to the API.")
+	keepAlive := flag.Duration("keepalive", defaultKeepAlive, "The TCP keep-alive period of connections to the API; negative disables keep-alives.")
+	dualStack := flag.Bool("dual-stack", true, "Race IPv6 and IPv4 connections to hosts with both kinds of addresses.")
+	dnsCacheTTL := flag.Duration("dns-cache-ttl", 0, "Cache the resolved addresses of the API host for this long (0 disables the cache).")
+	userAgent := flag.String("user-agent", defaultUserAgent(), "The User-Agent header sent with every request.")
+	showVersion := flag.Bool("version", false, "Print the application version, commit, and build date, then exit.")
 	flag.Parse()
 
+	// -list-attachments-only is a -list-only run listing attachments instead of
+	// requests, and is bound by the same restrictions.
+	if *listAttachmentsOnly {
+		*listOnly = true
+	}
+
+	// Keep standard output clean for NDJSON by sending all human-facing messages to stderr.
+	if *stdoutMode {
+		console.SetOutput(os.Stderr)
+	}
+
 	if *showVersion {
-		fmt.Println(version)
-		os.Exit(0)
+		console.Println(versionString())
+		exit(0)
+	}
+
+	// Expand variables such as ${DATE} in output paths, all against the same time.
+	now := time.Now()
+	for _, path := range []*string{outputDir, metadataDir, attachmentsDir, targzPath, bundlePath, sqlitePath, indexFile, logFile, stateFile, globalIndexPath, summaryJSON, reportHTML, auditLocal} {
+		expanded, err := expandPath(*path, now)
+		if err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		*path = expanded
+	}
+
+	// Tee log output to the log file, if any. Writes still go through the console
+	// printer, so lines from concurrent workers stay whole in the file too.
+	if *logFile != "" {
+		f, err := openLogFile(*logFile)
+		if err != nil {
+			console.Printf("Error: -log-file: %v\n", err)
+			exit(1)
+		}
+		log.SetOutput(console.Writer(io.MultiWriter(os.Stderr, f)))
+	}
+
+	// Load the tenants to export with -all-tenants, which supply their own credentials.
+	var tenants []Tenant
+	if *allTenants {
+		if *tenantsConfigPath == "" {
+			console.Println("Error: -all-tenants requires -tenants-config")
+			exit(1)
+		}
+		if *stdoutMode || *targzPath != "" || *listOnly || *confirm || *checkSpace || *follow || *resumeRun != "" || *stateFile != "" || *programID != 0 || *netrcFile != "" {
+			console.Println("Error: -all-tenants cannot be combined with -stdout, -targz, -list-only, -confirm, -check-disk-space, -follow, -resume-run, -state-file, -program-id, or -netrc-file")
+			exit(1)
+		}
+		var err error
+		if tenants, err = loadTenants(*tenantsConfigPath, *outputDir, now); err != nil {
+			console.Printf("Error: -tenants-config: %v\n", err)
+			exit(1)
+		}
+	}
+
+	// Take the token from -token, then from ZENGRC_TOKEN, then from the netrc
+	// entry of the API host.
+	if !*allTenants {
+		resolved, err := resolveToken(*token, *netrcFile, *apiURL)
+		if err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		*token = resolved
 	}
 
 	// Validate that required flags are provided.
-	if *apiURL == "" || *token == "" {
-		fmt.Println("Error: -api-url and -token flags are required.")
+	if !*allTenants && (*apiURL == "" || *token == "") {
+		console.Println("Error: -api-url and -token flags are required, unless the token is in ZENGRC_TOKEN or the -netrc-file.")
 		flag.Usage()
-		os.Exit(1)
+		exit(1)
+	}
+	if !*allTenants {
+		if err := checkToken(*token); err != nil {
+			console.Printf("Error: -token: %v\n", err)
+			exit(1)
+		}
+		warning, err := checkAPIURL(*apiURL)
+		if err != nil {
+			console.Printf("Error: -api-url: %v\n", err)
+			exit(1)
+		}
+		if warning != "" {
+			log.Printf("Warning: %s", warning)
+		}
+	}
+
+	if err := checkMode(*mode); err != nil {
+		console.Printf("Error: -mode: %v\n", err)
+		exit(1)
+	}
+
+	if err := checkPagination(*pagination); err != nil {
+		console.Printf("Error: -pagination: %v\n", err)
+		exit(1)
+	}
+
+	apiPrefixValue, err := checkAPIPrefix(*apiPrefix)
+	if err != nil {
+		console.Printf("Error: -api-prefix: %v\n", err)
+		exit(1)
+	}
+
+	fileModeValue, err := parseMode(*fileMode)
+	if err != nil {
+		console.Printf("Error: -file-mode: %v\n", err)
+		exit(1)
+	}
+	dirModeValue, err := parseMode(*dirMode)
+	if err != nil {
+		console.Printf("Error: -dir-mode: %v\n", err)
+		exit(1)
+	}
+
+	if *bundlePath != "" && (*stdoutMode || *noMetadata || *follow || *allTenants || *listOnly) {
+		console.Printf("Error: -bundle cannot be combined with -stdout, -no-metadata, -follow, -all-tenants, or -list-only\n")
+		exit(1)
+	}
+	if (*metadataDir != "" || *attachmentsDir != "") && (*stdoutMode || *allTenants) {
+		console.Printf("Error: -metadata-dir and -attachments-dir cannot be combined with -stdout or -all-tenants\n")
+		exit(1)
+	}
+	if *globalIndexPath != "" && (*stdoutMode || *allTenants || *listOnly) {
+		console.Printf("Error: -global-index cannot be combined with -stdout, -all-tenants, or -list-only\n")
+		exit(1)
+	}
+	if *reportHTML != "" && (*allTenants || *listOnly) {
+		console.Printf("Error: -report-html cannot be combined with -all-tenants or -list-only\n")
+		exit(1)
+	}
+	if *sqlitePath != "" && (*stdoutMode || *allTenants || *listOnly) {
+		console.Printf("Error: -sqlite cannot be combined with -stdout, -all-tenants, or -list-only\n")
+		exit(1)
+	}
+	if *sqlitePath != "" && !sqliteAvailable() {
+		console.Printf("Error: -sqlite: %v\n", errNoSQLite)
+		exit(1)
+	}
+	if *auditLocal != "" && (*stdoutMode || *allTenants || *listOnly || *flatten || *follow || *targzPath != "" || *bundlePath != "") {
+		console.Printf("Error: -audit-local cannot be combined with -stdout, -all-tenants, -list-only, -flatten, -follow, -targz, or -bundle\n")
+		exit(1)
+	}
+	if *metadataDir != "" && *noMetadata {
+		console.Printf("Error: -metadata-dir cannot be combined with -no-metadata\n")
+		exit(1)
+	}
+	if *stdoutMode && *noMetadata {
+		console.Printf("Error: -no-metadata cannot be combined with -stdout, which only streams metadata\n")
+		exit(1)
+	}
+	if *stdoutMode && (*targzPath != "" || *listOnly) {
+		console.Printf("Error: -stdout cannot be combined with -targz or -list-only\n")
+		exit(1)
+	}
+
+	if *follow && (*stdoutMode || *targzPath != "" || *listOnly) {
+		console.Printf("Error: -follow cannot be combined with -stdout, -targz, or -list-only\n")
+		exit(1)
+	}
+	if *follow && *pollInterval <= 0 {
+		console.Printf("Error: -poll-interval must be positive\n")
+		exit(1)
+	}
+
+	var customAttrThresholds []customAttrThreshold
+	for _, value := range customAttrMins {
+		threshold, err := parseCustomAttrThreshold(value)
+		if err != nil {
+			console.Printf("Error: -custom-attr-gte: %v\n", err)
+			exit(1)
+		}
+		customAttrThresholds = append(customAttrThresholds, threshold)
+	}
+
+	if *waitOnDiskFull < 0 {
+		console.Printf("Error: -wait-on-disk-full must not be negative\n")
+		exit(1)
+	}
+	if *maxErrorRate < 0 || *maxErrorRate > 1 {
+		console.Printf("Error: -max-error-rate must be between 0 and 1\n")
+		exit(1)
+	}
+	if *missingAttachment != missingSkip && *missingAttachment != missingWarn && *missingAttachment != missingFail {
+		console.Printf("Error: -missing-attachment must be %q, %q, or %q\n", missingSkip, missingWarn, missingFail)
+		exit(1)
+	}
+	if *undatedAttachments != undatedDownload && *undatedAttachments != undatedSkip {
+		console.Printf("Error: -undated-attachments must be %q or %q\n", undatedDownload, undatedSkip)
+		exit(1)
+	}
+	if *webhookURL != "" {
+		if u, err := url.Parse(*webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			console.Printf("Error: -webhook-url must be an http or https URL\n")
+			exit(1)
+		}
+	}
+	if *webhookSecret != "" && *webhookURL == "" {
+		console.Printf("Error: -webhook-secret requires -webhook-url\n")
+		exit(1)
+	}
+	if *postHookTimeout < 0 {
+		console.Printf("Error: -post-hook-timeout must not be negative\n")
+		exit(1)
+	}
+	if *maxRuntimePerRecord < 0 {
+		console.Printf("Error: -max-runtime-per-record must not be negative\n")
+		exit(1)
+	}
+	if *recordRetries < 0 {
+		console.Printf("Error: -record-retries must not be negative\n")
+		exit(1)
+	}
+	if *maxAttachments < 0 {
+		console.Printf("Error: -max-attachments must not be negative\n")
+		exit(1)
+	}
+	if *maxPages < 0 {
+		console.Printf("Error: -max-pages must not be negative\n")
+		exit(1)
+	}
+	if *validateSchema && *mode == modeAssessments {
+		console.Printf("Error: -validate-schema cannot be combined with -mode assessments\n")
+		exit(1)
+	}
+	if *schemaStrict && !*validateSchema {
+		console.Printf("Error: -schema-strict requires -validate-schema\n")
+		exit(1)
+	}
+	if *sinceLastRun && (*stdoutMode || *follow || *allTenants || *listOnly) {
+		console.Printf("Error: -since-last-run cannot be combined with -stdout, -follow, -all-tenants, or -list-only\n")
+		exit(1)
+	}
+	if *compress && (*stdoutMode || *globalIndexPath != "" || *bundlePath != "") {
+		console.Printf("Error: -compress cannot be combined with -stdout, -global-index, or -bundle\n")
+		exit(1)
+	}
+	if *fetchInline && (*stdoutMode || *flatten) {
+		console.Printf("Error: -fetch-inline cannot be combined with -stdout or -flatten\n")
+		exit(1)
+	}
+	if *startCursor != "" && (*maxPages > 0 || *follow || *allTenants || *listOnly || *idsFile != "") {
+		console.Printf("Error: -start-cursor cannot be combined with -max-pages, -follow, -all-tenants, -list-only, or -ids-file\n")
+		exit(1)
+	}
+	if *maxPages > 0 && (!*incremental || *follow || *allTenants || *listOnly || *idsFile != "") {
+		console.Printf("Error: -max-pages requires -incremental and cannot be combined with -follow, -all-tenants, -list-only, or -ids-file\n")
+		exit(1)
+	}
+
+	if *flattenNaming != flattenPrefixed && *flattenNaming != flattenOriginal {
+		console.Printf("Error: -flatten-naming must be %q or %q\n", flattenPrefixed, flattenOriginal)
+		exit(1)
+	}
+
+	var orderCompare func(a, b Request) int
+	if *order != "" {
+		if orderCompare, err = orderFunc(*order); err != nil {
+			console.Printf("Error: -order: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if *groupBy != "" && *groupBy != groupByStatus {
+		console.Printf("Error: -group-by must be %q\n", groupByStatus)
+		exit(1)
+	}
+	if *groupAttachmentsBy != "" && *groupAttachmentsBy != groupByExt {
+		console.Printf("Error: -group-attachments-by must be %q\n", groupByExt)
+		exit(1)
+	}
+
+	if *numWorkers < 0 {
+		console.Printf("Error: -workers must not be negative\n")
+		exit(1)
+	}
+	if *numWorkers == 0 {
+		*numWorkers = autoWorkers(runtime.NumCPU())
+		log.Printf("Using %d workers", *numWorkers)
+	}
+
+	opts := &options{
+		outputDir:  *outputDir,
+		overwrite:  *overwrite,
+		latestOnly: *latestOnly,
+		noMetadata: *noMetadata,
+		redact:     newRedactor(redactFields),
+		fileMode:   fileModeValue,
+		dirMode:    dirModeValue,
+		postHook:   strings.Fields(*postHook),
+		people:     newPeopleIndex(),
+		reviews:    newReviewReport(),
+		errors:     newErrorCounter(),
+
+		flatten:          *flatten,
+		flattenNaming:    *flattenNaming,
+		groupAttachments: *groupAttachmentsBy,
+		flatNames:        newNameRegistry(),
+		groupRecords:     *groupBy,
+		order:            orderCompare,
+
+		stdout: *stdoutMode,
+
+		workers:            *numWorkers,
+		targzPath:          *targzPath,
+		bundlePath:         *bundlePath,
+		sqlitePath:         *sqlitePath,
+		maxPages:           *maxPages,
+		maxAttachments:     *maxAttachments,
+		incremental:        *incremental || *follow,
+		onlyNewAttachments: *onlyNewAttachments,
+		sinceLastRun:       *sinceLastRun,
+		missingAttachment:  *missingAttachment,
+		fetchInline:        *fetchInline,
+		compress:           *compress,
+		recordRetries:      *recordRetries,
+		recordBaseDelay:    defaultRecordBaseDelay,
+		recordTimeout:      *maxRuntimePerRecord,
+		postHookTimeout:    *postHookTimeout,
+		waitOnDiskFull:     *waitOnDiskFull,
+		requireAttachments: *requireAttachments,
+		reportHTML:         *reportHTML,
+	}
+
+	if opts.includeDocuments, err = parseDocumentIDs(includeDocuments); err != nil {
+		console.Printf("Error: -document-id-include: %v\n", err)
+		exit(1)
+	}
+	if opts.excludeDocuments, err = parseDocumentIDs(excludeDocuments); err != nil {
+		console.Printf("Error: -document-id-exclude: %v\n", err)
+		exit(1)
+	}
+	if *attachmentsSince != "" {
+		if opts.attachmentsSince, err = parseSinceDate(*attachmentsSince); err != nil {
+			console.Printf("Error: -attachments-since: %v\n", err)
+			exit(1)
+		}
+		opts.skipUndated = *undatedAttachments == undatedSkip
+	}
+
+	opts.metadataDir, opts.attachmentsDir = opts.outputDir, opts.outputDir
+	if *metadataDir != "" {
+		opts.metadataDir = *metadataDir
+	}
+	if *attachmentsDir != "" {
+		opts.attachmentsDir = *attachmentsDir
+	}
+
+	// Load the records completed by a previous run, if resuming.
+	if *resumeRun != "" {
+		previous, err := loadManifest(*resumeRun)
+		if err != nil {
+			console.Printf("Error: failed to read manifest %s: %v\n", *resumeRun, err)
+			exit(1)
+		}
+		opts.completed = previous.completedRecords()
+		console.Printf("Resuming run: %d records already complete.\n", len(opts.completed))
+	}
+
+	// Load the checksums recorded by the previous run to skip unchanged files.
+	if *skipUnchanged {
+		opts.checksums = loadChecksums(filepath.Join(opts.outputDir, manifestFileName))
+	}
+
+	// Load the sync state of previous runs for an incremental sync.
+	if (*incremental || *follow || *onlyNewAttachments || *sinceLastRun) && !*allTenants {
+		path := *stateFile
+		if path == "" {
+			path = filepath.Join(opts.outputDir, stateFileName)
+		}
+		opts.state = loadState(path)
+	}
+
+	// Load the index of documents downloaded by earlier runs into any directory.
+	if *globalIndexPath != "" {
+		opts.global = loadGlobalIndex(*globalIndexPath)
+	}
+
+	// Read the targeted request IDs, if any, before contacting the API.
+	if *idsFile != "" {
+		opts.ids, err = readIDsFile(*idsFile)
+		if err != nil {
+			console.Printf("Error: -ids-file: %v\n", err)
+			exit(1)
+		}
+	}
+
+	// Make sure the output directories are usable before contacting the API.
+	if !opts.stdout && *auditLocal == "" && (!*listOnly || *indexFile == "") {
+		dirs := []string{opts.outputDir}
+		for _, dir := range []string{*metadataDir, *attachmentsDir} {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		if *allTenants {
+			dirs = dirs[:0]
+			for _, tenant := range tenants {
+				dirs = append(dirs, tenant.OutputDir)
+			}
+		}
+		for _, dir := range dirs {
+			if err := checkOutputDir(dir, opts.dirMode); err != nil {
+				console.Printf("Error: %v\n", err)
+				exit(1)
+			}
+		}
+	}
+
+	// Bound the whole run by the deadline, if any. Once it passes, fetching stops and
+	// in-flight requests are cancelled; completed files stay valid on disk.
+	ctx := context.Background()
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
 	}
 
 	// Initialize the ZenGRC API client.
-	client := NewClient(*apiURL, *token)
+	clientOpts := []Option{
+		WithFileMode(opts.fileMode),
+		WithRetries(*maxRetries, defaultRetryBaseDelay),
+		WithRetryBudget(*maxTotalRetries),
+		WithPageRetries(*pageRetries, defaultPageBaseDelay),
+		WithPagination(*pagination),
+		WithFileTimeout(*timeoutPerFile),
+		WithCircuitBreaker(*breakerThreshold, *breakerCooldown),
+		WithUserAgent(*userAgent),
+		WithAPIPrefix(apiPrefixValue),
+		WithDialer(*dialTimeout, *keepAlive, *dualStack),
+		WithDNSCache(*dnsCacheTTL),
+	}
+	if len(fields) > 0 {
+		// Ask for the fields that the filters, reports, and layout read from the list.
+		required := []string{"id", "title"}
+		if len(types) > 0 {
+			required = append(required, "type")
+		}
+		if *overdue || *noDueDate || *order == orderDueDate {
+			required = append(required, "due_date")
+		}
+		if *order == orderCreated {
+			required = append(required, "created_at")
+		}
+		if *programID != 0 {
+			required = append(required, "mapped")
+		}
+		if len(customAttrThresholds) > 0 {
+			required = append(required, "custom_attributes")
+		}
+		if *incremental || *follow || *sinceLastRun {
+			required = append(required, "updated_at")
+		}
+		if *groupBy == groupByStatus || *listOnly {
+			required = append(required, "status")
+		}
+		if *listOnly {
+			required = append(required, "code")
+		}
+		if *noMetadata {
+			required = append(required, "assignees", "requesters", "reviewers", "verifiers")
+		}
+		projected, err := listFields(fields, required)
+		if err != nil {
+			console.Printf("Error: -fields: %v\n", err)
+			exit(1)
+		}
+		clientOpts = append(clientOpts, WithListFields(projected))
+	}
+	if len(query) > 0 {
+		clientOpts = append(clientOpts, WithListQuery(url.Values(query)))
+	}
+	if !*noDetailsCache {
+		clientOpts = append(clientOpts, WithDetailsCache(defaultDetailsCacheSize, defaultDetailsCacheTTL))
+	}
+	if *trace {
+		clientOpts = append(clientOpts, WithTracing())
+	}
+	if *skipBadPages {
+		clientOpts = append(clientOpts, WithSkipBadPages())
+	}
+	if *validateSchema {
+		clientOpts = append(clientOpts, WithSchemaValidation(*schemaStrict))
+	}
+	if *streamList {
+		clientOpts = append(clientOpts, WithStreamingList())
+	}
+	if *mode == modeAssessments {
+		clientOpts = append(clientOpts, WithAssessments())
+	}
+	client := NewClient(*apiURL, *token, clientOpts...)
+
+	if len(types) > 0 {
+		opts.filters = append(opts.filters, typeFilter(types))
+	}
+	if *overdue || *noDueDate {
+		opts.filters = append(opts.filters, dueDateFilter(*overdue, *noDueDate, now))
+	}
+	if len(customAttrThresholds) > 0 {
+		opts.filters = append(opts.filters, customAttrFilter(customAttrThresholds))
+	}
+	if *sinceLastRun {
+		if last, ok := opts.state.lastRun(); ok {
+			console.Printf("Exporting requests updated since the last successful run at %s\n", last.Format(time.RFC3339))
+			opts.filters = append(opts.filters, updatedSinceFilter(last))
+		} else {
+			console.Printf("No successful run recorded in the state file; exporting all requests\n")
+		}
+	}
+
+	// Start the request list at the given page, normalized like a next link.
+	if *startCursor != "" {
+		if opts.startCursor, err = client.startCursor(*startCursor); err != nil {
+			console.Printf("Error: -start-cursor: %v\n", err)
+			exit(1)
+		}
+		console.Printf("Starting the request list at %s.\n", opts.startCursor)
+	}
+
+	// Restrict the export to a single program, confirming that the program exists.
+	if *programID != 0 {
+		program, err := findProgram(ctx, client, *programID)
+		if err != nil {
+			console.Printf("Error: -program-id: %v\n", err)
+			exit(1)
+		}
+		console.Printf("Exporting requests mapped to program %d - %s\n", program.ID, program.Title)
+		opts.filters = append(opts.filters, programFilter(program.ID))
+	}
+
+	// In list-only mode, write the request index, or the attachment inventory,
+	// and exit before any download.
+	if *listOnly && *listAttachmentsOnly {
+		path := *indexFile
+		if path == "" {
+			path = filepath.Join(opts.outputDir, "attachments.csv")
+		}
+		if err := runListAttachments(ctx, client, path, *numWorkers, opts); err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+	if *listOnly {
+		path := *indexFile
+		if path == "" {
+			path = filepath.Join(opts.outputDir, "index.csv")
+		}
+		if err := runListOnly(ctx, client, path, *countAttachments, *numWorkers, opts); err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// In audit mode, reconcile the existing output directory with the API and
+	// exit before any download.
+	if *auditLocal != "" {
+		if err := runAudit(ctx, client, *auditLocal, *numWorkers, opts); err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// Ask for confirmation once the size of the export is known.
+	if *confirm {
+		proceed, err := confirmDownload(ctx, client, opts, *numWorkers, *assumeYes)
+		if err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if !proceed {
+			console.Printf("Aborted.\n")
+			exit(0)
+		}
+	}
+
+	// Make sure the attachments fit on disk before downloading any of them.
+	if *checkSpace {
+		fits, err := checkDiskSpace(ctx, client, opts, opts.attachmentsDir, *numWorkers)
+		if err != nil {
+			console.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if !fits {
+			console.Printf("Error: not enough disk space for this run; free up space or narrow the export with filters.\n")
+			exit(1)
+		}
+	}
+
+	// Post the summary of the run, or of each -follow pass, if requested.
+	var hooks []*webhook
+	if *webhookURL != "" {
+		hooks = append(hooks, newWebhook(*webhookURL, *webhookSecret))
+	}
+	if *notifyURL != "" {
+		notifier, err := newChatNotifier(*notifyURL)
+		if err != nil {
+			console.Printf("Error: -notify: %v\n", err)
+			exit(1)
+		}
+		hooks = append(hooks, notifier)
+	}
+
+	// Export each tenant into its own output directory and report the combined summary.
+	if *allTenants {
+		summary := runTenants(ctx, tenants, opts, clientOpts, *tenantConcurrency, *incremental)
+		console.Printf("Combined summary of %d tenants:\n", len(tenants))
+		summary.print()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Deadline of %s reached: the run was stopped early; completed records are kept on disk", *deadline)
+			summary.ExitStatus = exitDeadline
+		}
+		summary.checkErrorRate(*maxErrorRate)
+		if *summaryJSON != "" {
+			if err := summary.write(*summaryJSON, opts.fileMode); err != nil {
+				log.Printf("Error writing summary JSON: %v", err)
+			}
+		}
+		for _, hook := range hooks {
+			hook.notify(ctx, summary)
+		}
+		exit(summary.ExitStatus)
+	}
+
+	// With -follow, stop between or during passes on an interrupt or termination signal.
+	if *follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	// Run a single pass or, with -follow, keep polling for new and updated requests.
+	var summary Summary
+	for pass := 1; ; pass++ {
+		var listErr error
+		summary, listErr = runPass(ctx, client, opts)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			summary.ExitStatus = exitDeadline
+		}
+		summary.checkErrorRate(*maxErrorRate)
+		fatal := *follow && ctx.Err() == nil && isFatal(listErr)
+		if fatal {
+			summary.ExitStatus = 1
+		}
+		if *summaryJSON != "" {
+			if err := summary.write(*summaryJSON, opts.fileMode); err != nil {
+				log.Printf("Error writing summary JSON: %v", err)
+			}
+		}
+		for _, hook := range hooks {
+			hook.notify(ctx, summary)
+		}
+		if !*follow || ctx.Err() != nil {
+			break
+		}
+		if fatal {
+			log.Printf("Stopping -follow after a fatal error: %v", listErr)
+			break
+		}
+
+		console.Printf("Pass %d complete; polling again in %s.\n", pass, *pollInterval)
+		if err := sleep(ctx, *pollInterval); err != nil {
+			break
+		}
+		// Later passes only pick up changes, with fresh details; reports start over
+		// for each pass, and so do the flattened names, so that a record processed
+		// again gets back the names of its earlier pass.
+		client.ClearDetailsCache()
+		opts.completed = nil
+		opts.people, opts.reviews, opts.errors = newPeopleIndex(), newReviewReport(), newErrorCounter()
+		opts.flatNames = newNameRegistry()
+		if opts.checksums != nil {
+			opts.checksums = loadChecksums(filepath.Join(opts.outputDir, manifestFileName))
+		}
+	}
+
+	if summary.ExitStatus == exitDeadline {
+		log.Printf("Deadline of %s reached: the run was stopped early; completed records are kept on disk", *deadline)
+	}
+	if summary.ExitStatus != 0 {
+		exit(summary.ExitStatus)
+	}
+	console.Close()
+}
+
+// runPass fetches the selected requests and processes them with the worker pool,
+// then writes the run files and prints the summary. It returns the summary and
+// the error that stopped the listing of requests, if any.
+func runPass(ctx context.Context, client *Client, opts *options) (Summary, error) {
+	started := time.Now()
+	manifest := newManifestRecorder()
+
+	// Stop the pass, or pause its writes, once the disk is full.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	opts.disk = newDiskGuard(opts.waitOnDiskFull, cancel)
+
+	// Open the tar.gz archive, if requested, before any record is processed.
+	var archive *tarArchive
+	if opts.targzPath != "" {
+		var err error
+		archive, err = newTarArchive(opts.targzPath, opts.fileMode)
+		if err != nil {
+			console.Printf("Error: failed to create archive %s: %v\n", opts.targzPath, err)
+			exit(1)
+		}
+	}
+
+	// Save the custom attribute definitions, so that the record values can be interpreted.
+	if !opts.stdout {
+		path, err := saveCustomAttributeDefinitions(ctx, client, opts)
+		if err != nil {
+			log.Printf("Error saving custom attribute definitions: %v", err)
+			opts.errors.add(err)
+		} else if path != "" && archive != nil {
+			archive.add(path, customAttributesFileName)
+		}
+	}
+
+	// Open the JSON bundle, if requested. It embeds every attachment, a third
+	// larger once base64-encoded, in a single file.
+	var bundle *jsonBundle
+	if opts.bundlePath != "" {
+		var err error
+		bundle, err = newJSONBundle(opts.bundlePath, opts.metadataDir, opts.attachmentsDir, opts.fileMode)
+		if err != nil {
+			console.Printf("Error: failed to create bundle %s: %v\n", opts.bundlePath, err)
+			exit(1)
+		}
+		log.Printf("Warning: -bundle embeds every attachment base64-encoded in %s, which grows about a third larger than the attachments themselves", opts.bundlePath)
+	}
+
+	// Open the SQLite index, if requested. It is updated in place, so that the
+	// records of earlier runs stay queryable.
+	var index *sqliteIndex
+	if opts.sqlitePath != "" {
+		var err error
+		index, err = openSQLiteIndex(opts.sqlitePath)
+		if err != nil {
+			console.Printf("Error: failed to open SQLite index %s: %v\n", opts.sqlitePath, err)
+			exit(1)
+		}
+	}
 
 	// Create channels for distributing requests and collecting errors.
 	requestsChan := make(chan Request)
-	errChan := make(chan error, *numWorkers)
+	errChan := make(chan error, opts.workers)
 	var wg sync.WaitGroup
 
 	// Start the worker pool. Each worker will process requests from the requestsChan.
-	for i := 0; i < *numWorkers; i++ {
+	for i := 0; i < opts.workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for request := range requestsChan {
-				if err := processRequest(client, request, *outputDir, *overwrite); err != nil {
+				if opts.stdout {
+					result, err := streamMetadata(ctx, client, request, opts.redact)
+					manifest.add(result)
+					if err != nil {
+						errChan <- fmt.Errorf("failed to stream request %d: %w", request.ID, err)
+					}
+					continue
+				}
+
+				result, err := processRecord(ctx, client, request, opts)
+				manifest.add(result)
+				if opts.state != nil && result.Complete {
+					opts.state.update(request, result.ETag, result.LatestUpload)
+				}
+				if archive != nil {
+					archiveRecord(archive, opts.metadataDir, opts.attachmentsDir, result)
+				}
+				if bundle != nil && err == nil {
+					bundle.add(result)
+				}
+				if index != nil {
+					index.add(request, result)
+				}
+				if err != nil {
 					errChan <- fmt.Errorf("failed to process request %d: %w", request.ID, err)
+				} else if len(opts.postHook) > 0 {
+					runPostHook(ctx, opts.postHook, filepath.Join(opts.attachmentsDir, result.recordDir()), request.ID, opts.postHookTimeout)
 				}
 			}
 		}()
@@ -61,24 +1020,63 @@ func main() {
 	// Start a goroutine to fetch all requests from the API and send them to the workers.
 	// This runs concurrently with the workers, allowing processing to start as soon as
 	// the first page of requests is fetched.
+	var listErr error
 	go func() {
-		var cursor string
-		for {
-			resp, err := client.GetRequests(cursor)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to get requests: %w", err)
-				break
+		dispatch := func(request Request) error {
+			if !selected(request, opts.filters) {
+				return nil
 			}
 
-			for _, request := range resp.Data {
-				requestsChan <- request
+			// Records unchanged since the last sync are skipped without any API calls.
+			if opts.incremental && opts.state.unchanged(request) {
+				console.Printf("Skipping request %d: unchanged since the last sync.\n", request.ID)
+				manifest.addUnchanged()
+				return nil
 			}
 
-			// Handle pagination.
-			if resp.Links.Next.Href == "" {
-				break
+			// Records completed by a resumed run are carried over without any API calls.
+			if previous, ok := opts.completed[request.ID]; ok {
+				console.Printf("Skipping request %d: already complete.\n", request.ID)
+				manifest.add(previous)
+				if archive != nil {
+					archiveRecord(archive, opts.metadataDir, opts.attachmentsDir, previous)
+				}
+				if bundle != nil {
+					bundle.add(previous)
+				}
+				if index != nil {
+					index.add(request, previous)
+				}
+				return nil
+			}
+			select {
+			case requestsChan <- request:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-			cursor = resp.Links.Next.Href
+		}
+
+		list := func(fn func(Request) error) error {
+			if opts.ids != nil {
+				return eachRequestByID(ctx, client, opts.ids, func(err error) { errChan <- err }, fn)
+			}
+			if opts.maxPages > 0 {
+				return eachRequestChunk(ctx, client, opts.state, opts.maxPages, fn)
+			}
+			if opts.startCursor != "" {
+				_, err := client.EachRequestFrom(ctx, opts.startCursor, 0, fn)
+				return err
+			}
+			return client.EachRequest(ctx, fn)
+		}
+		if opts.order != nil {
+			listErr = eachRequestInOrder(list, opts.order, dispatch)
+		} else {
+			listErr = list(dispatch)
+		}
+		if listErr != nil && opts.disk.stopped() == nil {
+			errChan <- fmt.Errorf("failed to get requests: %w", listErr)
 		}
 		close(requestsChan)
 	}()
@@ -90,57 +1088,555 @@ func main() {
 	}()
 
 	// Collect and log any errors that occurred during processing.
+	failures := 0
 	for err := range errChan {
+		var counted countedError
+		if !errors.As(err, &counted) {
+			opts.errors.add(err)
+		}
 		log.Println(err)
+		failures++
+	}
+	manifest.close()
+
+	// Only a pass that got every record completely moves the last successful
+	// run on, so that the next -since-last-run run picks up whatever was missed.
+	if opts.sinceLastRun && failures == 0 && listErr == nil && ctx.Err() == nil && manifest.allComplete() {
+		opts.state.setLastRun(started)
+	}
+
+	if !opts.stdout {
+		writeRunFiles(opts, manifest, archive)
+	}
+
+	summary := manifest.summarize(opts.requireAttachments, opts.errors)
+	summary.Retries, summary.RetryBudgetExhausted = client.retryStats()
+	if err := opts.disk.stopped(); err != nil {
+		summary.ExitStatus = 1
+		listErr = err
+	} else if listErr != nil && ctx.Err() == nil {
+		// A pass that could not list its requests failed, whatever its records.
+		summary.ExitStatus = 1
+	}
+	summary.print()
+	if opts.reportHTML != "" {
+		if err := manifest.writeHTMLReport(opts.reportHTML, client.collection, summary, opts.fileMode); err != nil {
+			log.Printf("Error writing HTML report: %v", err)
+		}
+	}
+
+	// Finalize the archive once every record and the manifest have been queued.
+	if archive != nil {
+		if err := archive.close(); err != nil {
+			log.Printf("Error finalizing archive %s: %v", opts.targzPath, err)
+		}
+	}
+	if bundle != nil {
+		if err := bundle.close(); err != nil {
+			log.Printf("Error finalizing bundle %s: %v", opts.bundlePath, err)
+		}
+	}
+	if index != nil {
+		if err := index.close(); err != nil {
+			log.Printf("Error finalizing SQLite index %s: %v", opts.sqlitePath, err)
+		}
+	}
+	return summary, listErr
+}
+
+// writeRunFiles writes the run manifest, so that an interrupted run can be resumed,
+// and the cross-record reports to the output directory.
+func writeRunFiles(opts *options, manifest *manifestRecorder, archive *tarArchive) {
+	manifestPath := filepath.Join(opts.outputDir, manifestFileName)
+	if err := makeDir(opts.outputDir, opts.dirMode); err != nil {
+		log.Printf("Error creating output directory: %v", err)
+		return
+	}
+	if err := manifest.write(manifestPath, opts.fileMode); err != nil {
+		log.Printf("Error writing manifest: %v", err)
+	} else if archive != nil {
+		archive.add(manifestPath, manifestFileName)
+	}
+
+	if err := opts.people.write(filepath.Join(opts.outputDir, peopleFileName), opts.fileMode); err != nil {
+		log.Printf("Error writing people index: %v", err)
+	}
+	if err := opts.reviews.write(filepath.Join(opts.outputDir, reviewsFileName), opts.fileMode); err != nil {
+		log.Printf("Error writing review report: %v", err)
+	}
+	if err := manifest.writeIncomplete(filepath.Join(opts.outputDir, incompleteFileName), opts.fileMode); err != nil {
+		log.Printf("Error writing incomplete records: %v", err)
+	}
+	if opts.state != nil {
+		if err := opts.state.save(opts.fileMode); err != nil {
+			log.Printf("Error writing state file: %v", err)
+		}
+	}
+	if opts.global != nil {
+		if err := opts.global.save(opts.fileMode); err != nil {
+			log.Printf("Error writing global index: %v", err)
+		}
 	}
 }
 
 // processRequest handles the processing of a single ZenGRC request. It creates a
 // directory for the record, saves its metadata, and downloads all associated attachments.
-func processRequest(client *Client, request Request, outputDir string, overwrite bool) error {
-	fmt.Printf("Processing request: %d - %s\n", request.ID, request.Title)
+// The returned RecordResult describes the outcome and is recorded in the run manifest.
+func processRequest(ctx context.Context, client *Client, request Request, opts *options) (RecordResult, error) {
+	console.Printf("Processing request: %d - %s\n", request.ID, request.Title)
+	relRecordDir := recordPath(opts, request)
+	result := RecordResult{ID: request.ID, Title: request.Title, Type: request.Type, Dir: filepath.ToSlash(relRecordDir)}
 
-	// Create a dedicated directory for the record.
-	recordDir := filepath.Join(outputDir, fmt.Sprintf("record_%d", request.ID))
-	if err := os.MkdirAll(recordDir, 0755); err != nil {
-		return fmt.Errorf("error creating directory for record %d: %w", request.ID, err)
+	// A record whose metadata could not be saved still gets its attachments;
+	// the metadata error is reported along with any later one.
+	var metadataErr error
+	fail := func(err error) (RecordResult, error) {
+		if metadataErr != nil && err != metadataErr {
+			err = errors.Join(metadataErr, err)
+		}
+		result.Error = err.Error()
+		return result, err
+	}
+	if err := opts.disk.stopped(); err != nil {
+		return fail(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
 	}
 
-	// Fetch and save the full metadata for the record.
-	if err := saveMetadata(client, request.ID, recordDir); err != nil {
-		return fmt.Errorf("error saving metadata for record %d: %w", request.ID, err)
+	// Create a dedicated directory for the record in the metadata and attachments
+	// trees, unless it would stay empty because the metadata is not saved or the
+	// attachments are flattened.
+	metadataDir := filepath.Join(opts.metadataDir, relRecordDir)
+	attachmentsDir := filepath.Join(opts.attachmentsDir, relRecordDir)
+	createDirs := []string{attachmentsDir}
+	if opts.flatten {
+		createDirs[0] = opts.attachmentsDir
 	}
+	if !opts.noMetadata && metadataDir != attachmentsDir {
+		createDirs = append(createDirs, metadataDir)
+	}
+	for _, dir := range createDirs {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		if err := makeDir(dir, opts.dirMode); err != nil {
+			return fail(fmt.Errorf("error creating directory for record %d: %w", request.ID, err))
+		}
+	}
+
+	// Fetch and save the full metadata for the record. Without metadata, the
+	// reports are built from the request as listed. The details are only
+	// redacted in what is saved and reported; the API calls that follow go by
+	// the details as returned, whose ID and links may be redacted fields.
+	details, redacted := &request, (*Request)(nil)
+	var err error
+	if !opts.noMetadata {
+		err = opts.disk.do(ctx, fmt.Sprintf("metadata of record %d", request.ID), func() error {
+			var fetched *Request
+			fetched, redacted, err = saveMetadata(ctx, client, request.ID, metadataDir, opts.fileMode, opts.redact)
+			if fetched != nil {
+				details = fetched
+			}
+			return err
+		})
+		switch {
+		case isDiskFull(err):
+			return fail(fmt.Errorf("error saving metadata for record %d: %w", request.ID, err))
+		case err != nil:
+			// Fall back to the request as listed to download the attachments.
+			metadataErr = fmt.Errorf("error saving metadata for record %d: %w", request.ID, err)
+			details, redacted = &request, nil
+		default:
+			result.MetadataSaved = true
+		}
+	}
+	if redacted == nil {
+		if redacted, err = opts.redact.request(details); err != nil {
+			if metadataErr != nil {
+				return fail(metadataErr)
+			}
+			return fail(fmt.Errorf("error redacting record %d: %w", request.ID, err))
+		}
+	}
+	opts.people.add(redacted)
+	opts.reviews.add(redacted)
+	result.ETag = details.ETag
 
 	// Fetch the list of attachments for the record.
-	attachments, err := client.GetAttachments(request.ID)
+	attachments, err := client.GetAttachmentsFor(ctx, details)
 	if err != nil {
-		return fmt.Errorf("error getting attachments for record %d: %w", request.ID, err)
+		return fail(fmt.Errorf("error getting attachments for record %d: %w", request.ID, err))
+	}
+	console.Printf("Record %d: %d attachments\n", request.ID, len(attachments))
+
+	// Flag records without evidence so that they stand out in completeness audits.
+	if len(attachments) == 0 {
+		log.Printf("Warning: record %d has no attachments", request.ID)
+		result.NoAttachments = true
+	}
+
+	// Keep or drop specific documents by ID.
+	if len(opts.includeDocuments) > 0 || len(opts.excludeDocuments) > 0 {
+		var included, excluded int
+		attachments, included, excluded = filterDocuments(attachments, opts.includeDocuments, opts.excludeDocuments)
+		if excluded > 0 {
+			console.Printf("Skipping %d attachments of record %d by document ID\n", excluded, request.ID)
+		}
+		result.DocumentsIncluded, result.DocumentsExcluded = included, excluded
+	}
+
+	// Drop superseded versions of the same document if only the latest is wanted.
+	if opts.latestOnly {
+		var skipped int
+		attachments, skipped = latestAttachments(attachments)
+		if skipped > 0 {
+			console.Printf("Skipping %d older attachment versions for record %d\n", skipped, request.ID)
+		}
+		result.SkippedVersions = skipped
+	}
+
+	// Drop the attachments seen by earlier runs if only new ones are wanted. The
+	// watermark moves on once the record is complete.
+	result.LatestUpload = latestUpload(attachments)
+	if opts.onlyNewAttachments {
+		if watermark, ok := opts.state.watermark(request.ID); ok {
+			var skipped int
+			attachments, skipped = attachmentsSince(attachments, watermark)
+			if skipped > 0 {
+				console.Printf("Skipping %d attachments of record %d uploaded before %s\n", skipped, request.ID, watermark.Format(time.RFC3339))
+			}
+			result.SkippedNotNew = skipped
+		}
+	}
+
+	// Drop the attachments uploaded before the date of interest.
+	if !opts.attachmentsSince.IsZero() {
+		var skipped int
+		attachments, skipped = attachmentsUploadedSince(attachments, opts.attachmentsSince, opts.skipUndated)
+		if skipped > 0 {
+			console.Printf("Skipping %d attachments of record %d uploaded before %s\n", skipped, request.ID, opts.attachmentsSince.Format(time.RFC3339))
+		}
+		result.SkippedBefore = skipped
+	}
+
+	// Keep a sample of the most recent attachments if the record has too many.
+	if opts.maxAttachments > 0 {
+		var skipped int
+		attachments, skipped = newestAttachments(attachments, opts.maxAttachments)
+		if skipped > 0 {
+			console.Printf("Skipping %d attachments of record %d over the limit of %d\n", skipped, request.ID, opts.maxAttachments)
+		}
+		result.SkippedOverMax = skipped
 	}
 
 	// Download each attachment.
+	result.Complete = true
+	result.AttachmentsTotal = len(attachments)
+	recordNames := newNameRegistry()
+	failed, missing := 0, 0
 	for _, attachment := range attachments {
-		fmt.Printf("Downloading attachment: %s\n", attachment.Name)
-		if err := client.DownloadAttachment(request.ID, attachment, recordDir, overwrite); err != nil {
+		if err := opts.disk.stopped(); err != nil {
+			result.Complete = false
+			return fail(err)
+		}
+		if err := ctx.Err(); err != nil {
+			result.Complete = false
+			return fail(err)
+		}
+		console.Printf("Downloading attachment: %s\n", attachment.Name)
+
+		// Attachments are saved in the record directory, or in the root of the
+		// attachments tree itself when flattening, under a name that no other
+		// attachment uses.
+		dir, relDir, target := attachmentsDir, relRecordDir, attachment
+		var collided bool
+		if opts.flatten {
+			dir, relDir = opts.attachmentsDir, ""
+			target.Name, collided = flatName(opts, request.ID, attachment)
+		} else {
+			target.Name, collided = recordName(recordNames, attachment)
+		}
+		if collided {
+			log.Printf("Warning: attachment %s of record %d collides with another attachment; saving it as %s", attachment.Name, request.ID, target.Name)
+			result.NameCollisions++
+		}
+
+		// Grouped attachments go into a subdirectory named after their extension.
+		if opts.groupAttachments == groupByExt {
+			group := attachmentGroup(target.Name)
+			dir, relDir = filepath.Join(dir, group), filepath.Join(relDir, group)
+			if err := makeDir(dir, opts.dirMode); err != nil {
+				return fail(fmt.Errorf("error creating directory for record %d: %w", request.ID, err))
+			}
+		}
+
+		path := filepath.Join(dir, target.Name)
+		entry := AttachmentResult{
+			DocumentID: attachment.DocumentID,
+			Name:       attachment.Name,
+			Path:       filepath.ToSlash(filepath.Join(relDir, target.Name)),
+			UploadedAt: attachment.UploadedAt,
+			Status:     attachmentDownloaded,
+		}
+
+		// With -compress, the attachment is downloaded to path, then stored
+		// gzipped, unless its type is compressed already.
+		storedPath := path
+		if opts.compress && shouldCompress(target.Name) {
+			storedPath += compressedExt
+			entry.Path += compressedExt
+			entry.Compressed = true
+		}
+
+		// Keep a local copy that still matches the checksum of the previous run,
+		// even when overwriting.
+		if opts.overwrite && opts.checksums != nil {
+			if sum, size, ok := opts.unchangedFile(request.ID, attachment, entry.Path, storedPath); ok {
+				console.Printf("File %s is unchanged. Skipping.\n", storedPath)
+				entry.Status, entry.SHA256, entry.Bytes = attachmentExisting, sum, size
+				result.Attachments = append(result.Attachments, entry)
+				continue
+			}
+		}
+		if entry.Compressed && !opts.overwrite {
+			if _, err := os.Stat(storedPath); err == nil {
+				console.Printf("File %s already exists. Skipping.\n", storedPath)
+				entry.Status = attachmentExisting
+				result.Attachments = append(result.Attachments, entry)
+				continue
+			}
+		}
+
+		// Link or copy a document that an earlier run already downloaded elsewhere.
+		if opts.global != nil {
+			var reused bool
+			err := opts.disk.do(ctx, path, func() error {
+				var err error
+				entry.SHA256, entry.Bytes, reused, err = opts.global.reuse(attachment, path, opts.overwrite, opts.fileMode)
+				return err
+			})
+			switch {
+			case isDiskFull(err):
+				entry.Status = attachmentFailed
+				entry.Error = err.Error()
+				result.Complete = false
+				result.Attachments = append(result.Attachments, entry)
+				return fail(err)
+			case err != nil:
+				log.Printf("Warning: cannot reuse the known copy of attachment %s for record %d, downloading it: %v", attachment.Name, request.ID, err)
+			case reused:
+				console.Printf("File %s is in the global index. Reusing it.\n", path)
+				entry.Status = attachmentReused
+				result.Attachments = append(result.Attachments, entry)
+				continue
+			}
+		}
+
+		var stats transferStats
+		err := opts.disk.do(ctx, path, func() error {
+			return client.downloadAttachment(ctx, request.ID, target, dir, opts.overwrite, &stats)
+		})
+		switch {
+		case err == nil:
+			entry.recordTransfer(&stats)
+			if sum, size, err := fileSHA256(path); err == nil {
+				entry.SHA256, entry.Bytes = sum, size
+				if opts.global != nil {
+					opts.global.add(attachment, path, sum, size)
+				}
+			}
+			if entry.Compressed {
+				// The manifest keeps the size and checksum of the original.
+				_, stored, err := compressFile(path, opts.fileMode)
+				if err != nil {
+					log.Printf("Warning: cannot compress %s, keeping it uncompressed: %v", path, err)
+					entry.Path, entry.Compressed = strings.TrimSuffix(entry.Path, compressedExt), false
+				}
+				entry.StoredBytes = stored
+			}
+		case errors.Is(err, ErrAttachmentExists):
+			// Left as stored by an earlier run, compressed or not.
+			console.Printf("File %s already exists. Skipping.\n", path)
+			entry.Status = attachmentExisting
+			entry.Path, entry.Compressed = strings.TrimSuffix(entry.Path, compressedExt), false
+			if opts.global != nil {
+				if sum, size, err := fileSHA256(path); err == nil {
+					opts.global.add(attachment, path, sum, size)
+				}
+			}
+		case classifyError(err) == categoryNotFound:
+			// Deleted since the attachments were listed, rather than a failure.
+			entry.Status = attachmentMissing
+			entry.Error = err.Error()
+			switch opts.missingAttachment {
+			case missingWarn:
+				log.Printf("Warning: attachment %s of record %d is missing remotely: %v", attachment.Name, request.ID, err)
+			case missingFail:
+				log.Printf("Error: attachment %s of record %d is missing remotely: %v", attachment.Name, request.ID, err)
+				opts.errors.add(err)
+				result.Complete = false
+				missing++
+			}
+		case isDiskFull(err):
+			// The run is stopping; the error is reported once, for the record.
+			entry.Status = attachmentFailed
+			entry.Error = err.Error()
+			result.Complete = false
+			result.Attachments = append(result.Attachments, entry)
+			return fail(err)
+		case err != nil:
 			log.Printf("Error downloading attachment %s for record %d: %v", attachment.Name, request.ID, err)
+			opts.errors.add(err)
+			entry.Status = attachmentFailed
+			entry.Error = err.Error()
+			result.Complete = false
+			failed++
+		}
+		result.Attachments = append(result.Attachments, entry)
+	}
+
+	// Download the files linked from the text fields of the record, which are
+	// evidence too even though they are not attachments.
+	inlineFailed := 0
+	if opts.fetchInline {
+		inline, n, err := fetchInline(ctx, client, details, attachmentsDir, relRecordDir, opts)
+		result.Inline, inlineFailed = inline, n
+		if err != nil {
+			result.Complete = false
+			return fail(err)
+		}
+	}
+
+	// A record missing any of its files fails. The files were counted in the
+	// summary errors one by one already, so the record itself is not.
+	var gaps []string
+	if failed > 0 {
+		gaps = append(gaps, fmt.Sprintf("%d attachments could not be downloaded", failed))
+	}
+	if missing > 0 {
+		gaps = append(gaps, fmt.Sprintf("%d attachments are missing remotely", missing))
+	}
+	if inlineFailed > 0 {
+		gaps = append(gaps, fmt.Sprintf("%d linked files could not be downloaded", inlineFailed))
+	}
+	if len(gaps) > 0 {
+		result.Complete = false
+		if metadataErr != nil {
+			opts.errors.add(metadataErr)
+		}
+		return fail(countedError{fmt.Errorf("record %d: %s", request.ID, strings.Join(gaps, ", "))})
+	}
+	if metadataErr != nil {
+		result.Complete = false
+		return fail(metadataErr)
+	}
+
+	// Once the record is complete under its current status, drop the copies left
+	// under the statuses it had in earlier runs.
+	if result.Complete && opts.groupRecords == groupByStatus {
+		removeStaleCopies(opts.attachmentsDir, request.ID, relRecordDir)
+		if opts.metadataDir != opts.attachmentsDir {
+			removeStaleCopies(opts.metadataDir, request.ID, relRecordDir)
+		}
+	}
+	return result, nil
+}
+
+// Default retries of a whole record, on top of the retries of each request.
+const (
+	defaultRecordRetries   = 2
+	defaultRecordBaseDelay = 10 * time.Second
+)
+
+// retryableRecordError reports whether processing a record again may succeed:
+// as with a request list page, after rate limiting, server, timeout, and
+// network errors, but not after permanent ones such as a 403 or a 404.
+func retryableRecordError(err error) bool {
+	return retryablePageError(err)
+}
+
+// errRecordTimeout is the cause of the cancellation of a record that ran past
+// -max-runtime-per-record.
+var errRecordTimeout = errors.New("record timeout")
+
+// processRecord is processRequest, processing the record again with backoff
+// while it fails with a transient error, so that a record is not abandoned
+// because fetching its details or its attachment list failed after all request
+// retries. The attachments saved by an earlier attempt are not downloaded again
+// unless overwriting.
+//
+// With a record timeout, the record is cancelled once it has run for that long,
+// retries included, and fails with errRecordTimeout, freeing the worker.
+func processRecord(ctx context.Context, client *Client, request Request, opts *options) (RecordResult, error) {
+	runCtx := ctx
+	if opts.recordTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.recordTimeout, errRecordTimeout)
+		defer cancel()
+	}
+	for attempt := 0; ; attempt++ {
+		result, err := processRequest(ctx, client, request, opts)
+		if attempt > 0 {
+			result.Attempts = attempt + 1
+		}
+		if (err != nil || !result.Complete) && runCtx.Err() == nil && errors.Is(context.Cause(ctx), errRecordTimeout) {
+			log.Printf("Record %d is still not done after %s; giving up on it", request.ID, opts.recordTimeout)
+			if err != nil {
+				err = fmt.Errorf("%w after %s: %w", errRecordTimeout, opts.recordTimeout, err)
+			} else {
+				err = fmt.Errorf("%w after %s", errRecordTimeout, opts.recordTimeout)
+			}
+			result.Error, result.TimedOut, result.Complete = err.Error(), true, false
+		}
+		if err == nil || attempt >= opts.recordRetries || ctx.Err() != nil || !retryableRecordError(err) {
+			return result, err
+		}
+		delay := backoff(opts.recordBaseDelay, attempt)
+		log.Printf("Processing record %d failed, retrying in %s (%d/%d): %v",
+			request.ID, delay.Round(time.Millisecond), attempt+1, opts.recordRetries, err)
+		if err := client.sleep(ctx, delay); err != nil {
+			return result, err
 		}
 	}
-	return nil
 }
 
-// saveMetadata fetches the full details of a request and saves it as a
-// metadata.json file in the specified directory.
-func saveMetadata(client *Client, requestID int, dir string) error {
-	req, err := client.GetRequestDetails(requestID)
+// Bounds of the automatic worker count used when -workers is 0.
+const (
+	workersPerCPU  = 2
+	maxAutoWorkers = 16
+)
+
+// autoWorkers derives a worker count from the number of CPUs. The work is
+// dominated by waiting on the API, so it runs two workers per CPU, capped so
+// large machines do not flood the API with concurrent requests.
+func autoWorkers(cpus int) int {
+	return max(1, min(cpus*workersPerCPU, maxAutoWorkers))
+}
+
+// saveMetadata fetches the full details of a request, redacts them, and saves
+// them as a metadata.json file in the specified directory with the given
+// permissions. It returns the details as fetched, to make further API calls
+// with, and as redacted, to report. The details are returned as fetched even
+// if saving them fails.
+func saveMetadata(ctx context.Context, client *Client, requestID int, dir string, mode os.FileMode, redact *redactor) (details, redacted *Request, err error) {
+	details, err = client.GetRequestDetails(ctx, requestID)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if redacted, err = redact.request(details); err != nil {
+		return details, nil, err
 	}
 
 	// Marshal the request details into a nicely formatted JSON string.
-	data, err := json.MarshalIndent(req, "", "  ")
+	data, err := json.MarshalIndent(redacted, "", "  ")
 	if err != nil {
-		return err
+		return details, nil, err
 	}
 
 	// Write the metadata to the file.
-	return os.WriteFile(filepath.Join(dir, "metadata.json"), data, 0644)
+	if err := writeFile(filepath.Join(dir, "metadata.json"), data, mode); err != nil {
+		return details, nil, err
+	}
+	return details, redacted, nil
 }
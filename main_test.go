@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestOptions returns the options of a run writing to a temporary directory.
+func newTestOptions(t *testing.T) *options {
+	t.Helper()
+	dir := t.TempDir()
+	return &options{
+		outputDir:         dir,
+		metadataDir:       dir,
+		attachmentsDir:    dir,
+		fileMode:          defaultFileMode,
+		dirMode:           defaultDirMode,
+		people:            newPeopleIndex(),
+		reviews:           newReviewReport(),
+		errors:            newErrorCounter(),
+		flatNames:         newNameRegistry(),
+		missingAttachment: missingWarn,
+		workers:           1,
+	}
+}
+
+// recordHandler serves record 1 with two attachments, failing the download of
+// the second with status.
+func recordHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/attachments"):
+			fmt.Fprint(w, `{"data": {"files": [{"document_id": 1, "name": "a.txt"}, {"document_id": 2, "name": "b.txt"}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/files/2"):
+			http.Error(w, `{"errors": [{"title": "Failed"}]}`, status)
+		case strings.Contains(r.URL.Path, "/files/"):
+			fmt.Fprint(w, "content")
+		default:
+			fmt.Fprint(w, `{"id": 1, "title": "Evidence"}`)
+		}
+	})
+}
+
+func TestProcessRequestFailedAttachment(t *testing.T) {
+	client := newTestClient(t, recordHandler(http.StatusInternalServerError), WithRetries(0, 0))
+	opts := newTestOptions(t)
+
+	result, err := processRequest(context.Background(), client, Request{ID: 1, Title: "Evidence"}, opts)
+	if err == nil || result.Error == "" || result.Complete {
+		t.Fatalf("processRequest = complete %t, error %q, %v; want a failed record", result.Complete, result.Error, err)
+	}
+	if len(result.Attachments) != 2 || result.Attachments[0].Status != attachmentDownloaded || result.Attachments[1].Status != attachmentFailed {
+		t.Errorf("attachments = %+v, want the first downloaded and the second failed", result.Attachments)
+	}
+
+	// The failed download is counted once, not again for the record.
+	var counted countedError
+	if !errors.As(err, &counted) {
+		t.Errorf("error %v is not marked as counted", err)
+	}
+	if got := opts.errors.snapshot(); len(got) != 1 || got[categoryServer] != 1 {
+		t.Errorf("error counts = %v, want server x1", got)
+	}
+
+	// The failed record counts toward -max-error-rate.
+	m := newManifestRecorder()
+	m.add(result)
+	m.add(RecordResult{ID: 2, Complete: true})
+	m.close()
+	summary := m.summarize(false, opts.errors)
+	if summary.RecordsFailed != 1 {
+		t.Errorf("summary records failed = %d, want 1", summary.RecordsFailed)
+	}
+	if summary.checkErrorRate(0.4); summary.ExitStatus != exitErrorRate {
+		t.Errorf("exit status = %d, want %d for a 50%% error rate", summary.ExitStatus, exitErrorRate)
+	}
+}
+
+func TestProcessRequestMissingAttachment(t *testing.T) {
+	client := newTestClient(t, recordHandler(http.StatusNotFound), WithRetries(0, 0))
+	opts := newTestOptions(t)
+	opts.missingAttachment = missingFail
+
+	result, err := processRequest(context.Background(), client, Request{ID: 1, Title: "Evidence"}, opts)
+	if err == nil || result.Error == "" {
+		t.Fatalf("processRequest = %v, want the record failed", err)
+	}
+	var counted countedError
+	if !errors.As(err, &counted) {
+		t.Errorf("error %v is not marked as counted", err)
+	}
+	if got := opts.errors.snapshot(); len(got) != 1 || got[categoryNotFound] != 1 {
+		t.Errorf("error counts = %v, want not-found x1", got)
+	}
+}
+
+// treeFiles returns the files under dir, relative to it.
+func treeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestProcessRequestCancelled(t *testing.T) {
+	t.Run("before setup", func(t *testing.T) {
+		client := newTestClient(t, recordHandler(http.StatusOK))
+		opts := newTestOptions(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := processRequest(ctx, client, Request{ID: 1, Title: "Evidence"}, opts); !errors.Is(err, context.Canceled) {
+			t.Fatalf("processRequest = %v, want %v", err, context.Canceled)
+		}
+		if entries, err := os.ReadDir(opts.outputDir); err != nil || len(entries) != 0 {
+			t.Errorf("output directory holds %v (%v), want nothing", entries, err)
+		}
+	})
+
+	t.Run("during downloads", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		records := recordHandler(http.StatusOK)
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The run is cancelled while the first attachment is served.
+			if strings.HasSuffix(r.URL.Path, "/files/1") {
+				cancel()
+			}
+			records.ServeHTTP(w, r)
+		}), WithRetries(0, 0))
+		opts := newTestOptions(t)
+
+		result, err := processRequest(ctx, client, Request{ID: 1, Title: "Evidence"}, opts)
+		if !errors.Is(err, context.Canceled) || result.Complete {
+			t.Fatalf("processRequest = complete %t, %v; want an incomplete record cancelled", result.Complete, err)
+		}
+		for _, file := range treeFiles(t, opts.outputDir) {
+			if name := filepath.Base(file); name == "b.txt" || strings.HasSuffix(name, ".part") {
+				t.Errorf("%s was created after the cancellation", file)
+			}
+		}
+	})
+}
+
+func TestRunPassListFailure(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors": [{"title": "Failed"}]}`, http.StatusInternalServerError)
+	}), WithRetries(0, 0), WithPageRetries(0, 0))
+	opts := newTestOptions(t)
+
+	summary, err := runPass(context.Background(), client, opts)
+	if err == nil {
+		t.Fatal("runPass succeeded, want the listing error")
+	}
+	if summary.Records != 0 || summary.ExitStatus == 0 {
+		t.Errorf("summary = %d records, exit status %d; want no records and a failed run", summary.Records, summary.ExitStatus)
+	}
+}
+
+func TestRunTenantsListFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors": [{"title": "Failed"}]}`, http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(empty.Close)
+
+	opts := newTestOptions(t)
+	tenants := []Tenant{
+		{Name: "ok", APIURL: empty.URL, Token: "key:secret", OutputDir: filepath.Join(opts.outputDir, "ok")},
+		{Name: "failing", APIURL: failing.URL, Token: "key:secret", OutputDir: filepath.Join(opts.outputDir, "failing")},
+	}
+	summary := runTenants(context.Background(), tenants, opts, []Option{WithRetries(0, 0), WithPageRetries(0, 0)}, 2, false)
+	if summary.ExitStatus == 0 {
+		t.Error("combined exit status = 0, want the failed listing of a tenant to fail the run")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestFileName is the name of the run manifest written to the output directory.
+const manifestFileName = "manifest.json"
+
+// incompleteFileName is the name of the list of incomplete records written to the output directory.
+const incompleteFileName = "incomplete_records.json"
+
+// Manifest records the outcome of a run so that later runs can build on it.
+type Manifest struct {
+	Version    string         `json:"version"`
+	Commit     string         `json:"commit"`
+	StartedAt  string         `json:"started_at"`
+	FinishedAt string         `json:"finished_at"`
+	Unchanged  int            `json:"unchanged,omitempty"`
+	Records    []RecordResult `json:"records"`
+}
+
+// RecordResult captures what happened to a single request during a run.
+type RecordResult struct {
+	ID              int                `json:"id"`
+	Title           string             `json:"title"`
+	Type            string             `json:"type,omitempty"`
+	Dir             string             `json:"dir,omitempty"`
+	Complete        bool               `json:"complete"`
+	Attachments     []AttachmentResult `json:"attachments"`
+	NoAttachments   bool               `json:"no_attachments,omitempty"`
+	SkippedVersions int                `json:"skipped_versions,omitempty"`
+	SkippedNotNew   int                `json:"skipped_not_new,omitempty"`
+	SkippedBefore   int                `json:"skipped_before,omitempty"`
+	SkippedOverMax  int                `json:"skipped_over_max,omitempty"`
+	LatestUpload    string             `json:"latest_upload,omitempty"`
+	NameCollisions  int                `json:"name_collisions,omitempty"`
+	Error           string             `json:"error,omitempty"`
+
+	// MetadataSaved and the attachment counts tell which part of an
+	// incomplete record is missing.
+	MetadataSaved     bool `json:"metadata_saved"`
+	AttachmentsTotal  int  `json:"attachments_total"`
+	AttachmentsOK     int  `json:"attachments_ok"`
+	AttachmentsFailed int  `json:"attachments_failed"`
+
+	// DocumentsIncluded and DocumentsExcluded count the attachments matched
+	// and dropped by -document-id-include and -document-id-exclude.
+	DocumentsIncluded int `json:"documents_included,omitempty"`
+	DocumentsExcluded int `json:"documents_excluded,omitempty"`
+
+	// Inline lists the files linked from the text fields of the record, with
+	// -fetch-inline.
+	Inline []InlineResult `json:"inline,omitempty"`
+
+	// Attempts is how many times the record was processed, when -record-retries
+	// processed it again after a transient failure.
+	Attempts int `json:"attempts,omitempty"`
+
+	// TimedOut tells that the record was stopped by -max-runtime-per-record.
+	TimedOut bool `json:"timed_out,omitempty"`
+
+	// ETag is the entity tag of the record details, kept in the state file.
+	ETag string `json:"-"`
+}
+
+// recordDir returns the directory of the record relative to the output directory.
+// Manifests written before records could be grouped do not record it.
+func (r RecordResult) recordDir() string {
+	if r.Dir == "" {
+		return recordDirName(r.ID)
+	}
+	return filepath.FromSlash(r.Dir)
+}
+
+// AttachmentResult captures what happened to a single attachment during a run.
+type AttachmentResult struct {
+	DocumentID int    `json:"document_id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	UploadedAt string `json:"uploaded_at,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+
+	// The timing of the transfer of a downloaded attachment: when the body
+	// started and finished arriving, the time spent receiving it, and the
+	// resulting throughput.
+	DownloadStarted  string  `json:"download_started,omitempty"`
+	DownloadFinished string  `json:"download_finished,omitempty"`
+	DownloadSeconds  float64 `json:"download_seconds,omitempty"`
+	MBPerSecond      float64 `json:"mb_per_second,omitempty"`
+
+	// Compressed tells that the attachment is stored gzipped at Path, by
+	// -compress, in StoredBytes; Bytes and SHA256 are those of the original.
+	Compressed  bool  `json:"compressed,omitempty"`
+	StoredBytes int64 `json:"stored_bytes,omitempty"`
+}
+
+// recordTransfer records the timing of the download of the attachment.
+func (a *AttachmentResult) recordTransfer(stats *transferStats) {
+	if stats.start.IsZero() {
+		return
+	}
+	a.DownloadStarted = stats.start.UTC().Format(time.RFC3339Nano)
+	a.DownloadFinished = stats.end.UTC().Format(time.RFC3339Nano)
+	a.DownloadSeconds = math.Round(stats.elapsed.Seconds()*1e6) / 1e6
+	a.MBPerSecond = math.Round(stats.mbPerSecond()*1e6) / 1e6
+}
+
+// Attachment statuses recorded in the manifest.
+const (
+	attachmentDownloaded = "downloaded"
+	attachmentExisting   = "existing"
+	attachmentReused     = "reused"
+	attachmentFailed     = "failed"
+	// attachmentMissing is an attachment listed for its record that the API
+	// no longer has when it is downloaded, typically deleted in between.
+	attachmentMissing = "missing"
+)
+
+// Policies of -missing-attachment for attachments missing remotely.
+const (
+	missingSkip = "skip"
+	missingWarn = "warn"
+	missingFail = "fail"
+)
+
+// manifestBufferSize is the number of record results that workers can queue
+// for the manifest before they wait for the collector.
+const manifestBufferSize = 1024
+
+// manifestRecorder collects record results from concurrent workers. Results are
+// queued on a buffered channel and appended in batches by a single collector
+// goroutine, so workers do not contend on a lock for every record. close must be
+// called once every result has been added, before the manifest is read.
+type manifestRecorder struct {
+	results chan RecordResult
+	done    chan struct{}
+
+	mu       sync.Mutex
+	started  time.Time
+	manifest Manifest
+}
+
+// newManifestRecorder creates a recorder stamped with the build version and the
+// current time as the run start, and starts its collector goroutine.
+func newManifestRecorder() *manifestRecorder {
+	started := time.Now()
+	m := &manifestRecorder{
+		results: make(chan RecordResult, manifestBufferSize),
+		done:    make(chan struct{}),
+		started: started,
+		manifest: Manifest{
+			Version:   appVersion(),
+			Commit:    buildCommit(),
+			StartedAt: started.UTC().Format(time.RFC3339),
+		},
+	}
+	go m.run()
+	return m
+}
+
+// add queues the result for a single request. It is safe for concurrent use.
+func (m *manifestRecorder) add(result RecordResult) {
+	result.AttachmentsOK, result.AttachmentsFailed = 0, 0
+	for _, attachment := range result.Attachments {
+		switch attachment.Status {
+		case attachmentFailed:
+			result.AttachmentsFailed++
+		case attachmentMissing:
+		default:
+			result.AttachmentsOK++
+		}
+	}
+	m.results <- result
+}
+
+// close waits for the queued results to be collected.
+func (m *manifestRecorder) close() {
+	close(m.results)
+	<-m.done
+}
+
+// run appends queued results to the manifest until the channel is closed,
+// taking whatever else is queued along with each result so that the lock is
+// taken once per batch.
+func (m *manifestRecorder) run() {
+	defer close(m.done)
+	batch := make([]RecordResult, 0, manifestBufferSize)
+	for result := range m.results {
+		batch = append(batch[:0], result)
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case result, ok := <-m.results:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, result)
+			default:
+				break drain
+			}
+		}
+
+		m.mu.Lock()
+		m.manifest.Records = append(m.manifest.Records, batch...)
+		m.mu.Unlock()
+	}
+}
+
+// addUnchanged counts a record skipped because it is unchanged since the last sync.
+func (m *manifestRecorder) addUnchanged() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.manifest.Unchanged++
+}
+
+// allComplete reports whether every record collected so far is complete.
+func (m *manifestRecorder) allComplete() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range m.manifest.Records {
+		if !record.Complete {
+			return false
+		}
+	}
+	return true
+}
+
+// write stamps the finish time and saves the manifest, sorted by record ID, to
+// path. The file is written outside the lock, and atomically, since resumed and
+// incremental runs read it back.
+func (m *manifestRecorder) write(path string, mode os.FileMode) error {
+	m.mu.Lock()
+	m.manifest.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	sort.Slice(m.manifest.Records, func(i, j int) bool {
+		return m.manifest.Records[i].ID < m.manifest.Records[j].ID
+	})
+	data, err := json.MarshalIndent(m.manifest, "", "  ")
+	m.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, mode)
+}
+
+// writeIncomplete saves the records that are not complete, sorted by record ID,
+// to path, so that a later run can target exactly those records. An empty list
+// is written when every record is complete.
+func (m *manifestRecorder) writeIncomplete(path string, mode os.FileMode) error {
+	m.mu.Lock()
+	incomplete := []RecordResult{}
+	for _, record := range m.manifest.Records {
+		if !record.Complete {
+			incomplete = append(incomplete, record)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(incomplete, func(i, j int) bool { return incomplete[i].ID < incomplete[j].ID })
+	data, err := json.MarshalIndent(incomplete, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, mode)
+}
+
+// loadManifest reads a manifest written by a previous run.
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// completedRecords returns the records of the manifest that were fully downloaded, keyed by ID.
+func (m *Manifest) completedRecords() map[int]RecordResult {
+	completed := make(map[int]RecordResult)
+	for _, record := range m.Records {
+		if record.Complete {
+			completed[record.ID] = record
+		}
+	}
+	return completed
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// addConcurrently adds the results of records records to m, spread over
+// workers goroutines.
+func addConcurrently(m *manifestRecorder, workers, records int) {
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := w; id < records; id += workers {
+				m.add(RecordResult{ID: id, Complete: true, Attachments: []AttachmentResult{{Status: attachmentDownloaded}}})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestManifestRecorderConcurrent(t *testing.T) {
+	const records = 5000
+	m := newManifestRecorder()
+	addConcurrently(m, 16, records)
+	m.close()
+
+	if got := len(m.manifest.Records); got != records {
+		t.Fatalf("collected %d records, want %d", got, records)
+	}
+	seen := make(map[int]bool, records)
+	for _, record := range m.manifest.Records {
+		if seen[record.ID] {
+			t.Errorf("record %d collected twice", record.ID)
+		}
+		seen[record.ID] = true
+		if record.AttachmentsOK != 1 {
+			t.Errorf("record %d: %d attachments ok, want 1", record.ID, record.AttachmentsOK)
+		}
+	}
+	if !m.allComplete() {
+		t.Error("allComplete = false, want true")
+	}
+}
+
+func BenchmarkManifestRecorder(b *testing.B) {
+	const records = 10000
+	for b.Loop() {
+		m := newManifestRecorder()
+		addConcurrently(m, 16, records)
+		m.close()
+	}
+}
+
+func TestManifestRecorderWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifestFileName)
+	if err := os.WriteFile(path, []byte(`{"records": [{"id": 9}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newManifestRecorder()
+	m.add(RecordResult{ID: 2, Complete: true})
+	m.add(RecordResult{ID: 1, Complete: true})
+	m.close()
+	if err := m.write(path, 0o640); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// The manifest replaces the previous one as a whole, sorted by record ID,
+	// leaving no temporary file behind.
+	manifest, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Records) != 2 || manifest.Records[0].ID != 1 || manifest.Records[1].ID != 2 {
+		t.Errorf("manifest records = %+v, want 1 and 2", manifest.Records)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the manifest", len(entries))
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if got := info.Mode().Perm(); got != 0o640 {
+		t.Errorf("mode = %o, want 640", got)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// netrcEntry is a machine, or the default, entry of a netrc file.
+type netrcEntry struct {
+	machine  string // Empty for the default entry.
+	login    string
+	password string
+}
+
+// parseNetrc parses the entries of a netrc file: machine and default entries
+// with their login and password, skipping account tokens, macro definitions,
+// and comments.
+func parseNetrc(data []byte) ([]netrcEntry, error) {
+	var entries []netrcEntry
+	var entry *netrcEntry
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	inMacro := false
+	for lineNo := 1; lines.Scan(); lineNo++ {
+		line := lines.Text()
+		if inMacro {
+			// A macro definition runs until the next empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			value := func() (string, error) {
+				if i+1 >= len(fields) {
+					return "", fmt.Errorf("line %d: %s has no value", lineNo, field)
+				}
+				i++
+				return fields[i], nil
+			}
+			switch field {
+			case "machine":
+				machine, err := value()
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, netrcEntry{machine: machine})
+				entry = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				entry = &entries[len(entries)-1]
+			case "login", "password", "account":
+				v, err := value()
+				if err != nil {
+					return nil, err
+				}
+				if entry == nil {
+					return nil, fmt.Errorf("line %d: %s outside of a machine entry", lineNo, field)
+				}
+				switch field {
+				case "login":
+					entry.login = v
+				case "password":
+					entry.password = v
+				}
+			case "macdef":
+				if _, err := value(); err != nil {
+					return nil, err
+				}
+				inMacro = true
+				i = len(fields)
+			default:
+				return nil, fmt.Errorf("line %d: unexpected %q", lineNo, field)
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// netrcToken looks up the token of apiURL in the netrc file at path: the
+// login and password of the machine entry matching its host, with or without
+// its port, or of the default entry, joined as key_id:key_secret. It returns
+// false when no entry matches, so that the token is left to -token.
+func netrcToken(path, apiURL string) (string, bool, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+		log.Printf("Warning: %s can be read by other users; restrict it with chmod 600", path)
+	}
+	entries, err := parseNetrc(data)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// The first entry of the host with its port wins, then the first of the
+	// host, then the default entry, which comes last in a netrc file.
+	var match *netrcEntry
+	for _, host := range []string{u.Host, u.Hostname(), ""} {
+		for i := range entries {
+			if strings.EqualFold(entries[i].machine, host) {
+				match = &entries[i]
+				break
+			}
+		}
+		if match != nil {
+			break
+		}
+	}
+	if match == nil {
+		return "", false, nil
+	}
+	token := match.login + ":" + match.password
+	if err := checkToken(token); err != nil {
+		return "", false, fmt.Errorf("%s: entry of %s: %w", path, u.Hostname(), err)
+	}
+	return token, true, nil
+}
+
+// tokenEnv is the environment variable read for the token when -token is not set.
+const tokenEnv = "ZENGRC_TOKEN"
+
+// resolveToken returns the token to use, in order of precedence: flagToken,
+// the ZENGRC_TOKEN environment variable, then the netrc entry of apiURL when a
+// netrc file is given. An empty token is returned when none of them has one.
+func resolveToken(flagToken, netrcPath, apiURL string) (string, error) {
+	if flagToken != "" {
+		return flagToken, nil
+	}
+	if token := os.Getenv(tokenEnv); token != "" {
+		return token, nil
+	}
+	if netrcPath == "" || apiURL == "" {
+		return "", nil
+	}
+	token, found, err := netrcToken(netrcPath, apiURL)
+	if err != nil {
+		return "", fmt.Errorf("-netrc-file: %w", err)
+	}
+	if !found {
+		log.Printf("Warning: %s has no entry for the host of -api-url", netrcPath)
+	}
+	return token, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	const data = `# Tokens of the ZenGRC hosts
+machine api.example.com:8443 login k1 password s1
+machine api.example.com
+	login k2
+	account ignored
+	password s2
+
+macdef init
+cd /tmp
+machine not.an.entry login x password y
+
+default login k3 password s3
+`
+	entries, err := parseNetrc([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netrcEntry{
+		{"api.example.com:8443", "k1", "s1"},
+		{"api.example.com", "k2", "s2"},
+		{"", "k3", "s3"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"login k1", "machine", "machine a host b"} {
+		if _, err := parseNetrc([]byte(bad)); err == nil {
+			t.Errorf("parseNetrc(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte("machine api.example.com login netrc password secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const apiURL = "https://api.example.com/api/v2"
+
+	tests := []struct {
+		name, flag, env, netrc, want string
+	}{
+		{"flag first", "flag:secret", "env:secret", path, "flag:secret"},
+		{"environment before netrc", "", "env:secret", path, "env:secret"},
+		{"netrc last", "", "", path, "netrc:secret"},
+		{"none", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tokenEnv, tt.env)
+			got, err := resolveToken(tt.flag, tt.netrc, apiURL)
+			if err != nil || got != tt.want {
+				t.Errorf("resolveToken = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// A netrc file without an entry of the host leaves the token empty.
+	t.Setenv(tokenEnv, "")
+	if got, err := resolveToken("", path, "https://other.example.com"); err != nil || got != "" {
+		t.Errorf("resolveToken for another host = %q, %v; want no token", got, err)
+	}
+}
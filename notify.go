@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chat services of -notify, named by the scheme of its target.
+const (
+	notifySlack = "slack"
+	notifyTeams = "teams"
+)
+
+// Colors of the -notify messages of successful and failed runs.
+const (
+	notifyColorOK     = "2EB886"
+	notifyColorFailed = "D00000"
+)
+
+// newChatNotifier creates the webhook of a -notify target: the incoming
+// webhook URL of a Slack or Microsoft Teams channel, with its https scheme
+// replaced by slack:// or teams://, as in slack://hooks.slack.com/services/...
+func newChatNotifier(target string) (*webhook, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.New("invalid URL") // Left out, as it holds the webhook secret.
+	}
+	var name string
+	var payload func(event string, summary Summary) ([]byte, error)
+	switch u.Scheme {
+	case notifySlack:
+		name, payload = "Slack notification", slackMessage
+	case notifyTeams:
+		name, payload = "Teams notification", teamsMessage
+	default:
+		return nil, errors.New("expected a slack:// or teams:// URL")
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing the host of the webhook")
+	}
+	u.Scheme = "https"
+	return &webhook{name: name, url: u.String(), payload: payload, client: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// notifyFact is a labelled figure of a -notify message.
+type notifyFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// notifyTitle returns the headline of a -notify message.
+func notifyTitle(event string, summary Summary) string {
+	if event == webhookRunFailed {
+		return fmt.Sprintf("ZenGRC export failed (exit status %d)", summary.ExitStatus)
+	}
+	return "ZenGRC export completed"
+}
+
+// notifyFacts returns the figures of a -notify message: the records processed,
+// the failures, and the duration of the run.
+func notifyFacts(summary Summary) []notifyFact {
+	facts := []notifyFact{
+		{"Records", fmt.Sprintf("%d (%d complete, %d failed)", summary.Records, summary.RecordsComplete, summary.RecordsFailed)},
+		{"Attachments", fmt.Sprintf("%d downloaded, %d already present, %d failed", summary.AttachmentsDownloaded, summary.AttachmentsExisting, summary.AttachmentsFailed)},
+	}
+	if summary.AttachmentsMissing > 0 {
+		facts = append(facts, notifyFact{"Missing", strconv.Itoa(summary.AttachmentsMissing) + " attachments"})
+	}
+	if len(summary.Errors) > 0 {
+		facts = append(facts, notifyFact{"Errors", formatCounts(summary.Errors)})
+	}
+	duration := time.Duration(summary.DurationSeconds * float64(time.Second)).Round(time.Second)
+	return append(facts, notifyFact{"Duration", duration.String()})
+}
+
+// slackMessage formats the summary of a run as a Slack message with a colored
+// attachment holding its figures.
+func slackMessage(event string, summary Summary) ([]byte, error) {
+	color := notifyColorOK
+	if event == webhookRunFailed {
+		color = notifyColorFailed
+	}
+	var text strings.Builder
+	for _, fact := range notifyFacts(summary) {
+		fmt.Fprintf(&text, "*%s:* %s\n", fact.Name, fact.Value)
+	}
+	title := notifyTitle(event, summary)
+	return json.Marshal(map[string]any{
+		"text": title,
+		"attachments": []map[string]any{{
+			"color":     "#" + color,
+			"fallback":  title,
+			"text":      strings.TrimSuffix(text.String(), "\n"),
+			"mrkdwn_in": []string{"text"},
+		}},
+	})
+}
+
+// teamsMessage formats the summary of a run as a Microsoft Teams message card.
+func teamsMessage(event string, summary Summary) ([]byte, error) {
+	color := notifyColorOK
+	if event == webhookRunFailed {
+		color = notifyColorFailed
+	}
+	title := notifyTitle(event, summary)
+	return json.Marshal(map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    title,
+		"title":      title,
+		"themeColor": color,
+		"sections":   []map[string]any{{"facts": notifyFacts(summary)}},
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Processing orders accepted by -order.
+const (
+	orderIDAsc   = "id-asc"
+	orderIDDesc  = "id-desc"
+	orderDueDate = "due-date"
+	orderCreated = "created"
+)
+
+// orderFunc returns the comparison implementing a processing order. Ties, and
+// requests whose dates are missing or invalid, which sort last, fall back to
+// ascending ID so that the order is fully deterministic.
+func orderFunc(order string) (func(a, b Request) int, error) {
+	byID := func(a, b Request) int { return cmp.Compare(a.ID, b.ID) }
+	byTime := func(key func(Request) (time.Time, bool)) func(a, b Request) int {
+		return func(a, b Request) int {
+			ta, okA := key(a)
+			tb, okB := key(b)
+			switch {
+			case okA && okB:
+				if c := ta.Compare(tb); c != 0 {
+					return c
+				}
+			case okA != okB:
+				if okA {
+					return -1
+				}
+				return 1
+			}
+			return byID(a, b)
+		}
+	}
+
+	switch order {
+	case orderIDAsc:
+		return byID, nil
+	case orderIDDesc:
+		return func(a, b Request) int { return byID(b, a) }, nil
+	case orderDueDate:
+		return byTime(func(r Request) (time.Time, bool) {
+			t, err := parseDueDate(r.GetDueDate())
+			return t, err == nil
+		}), nil
+	case orderCreated:
+		return byTime(func(r Request) (time.Time, bool) {
+			t, err := time.Parse(time.RFC3339, r.CreatedAt)
+			return t, err == nil
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown order %q: must be %s, %s, %s, or %s", order, orderIDAsc, orderIDDesc, orderDueDate, orderCreated)
+}
+
+// eachRequestInOrder buffers every request produced by list, sorts them with
+// compare, and only then calls fn for each, so the whole request list is held
+// in memory. If listing fails, the requests gathered so far are still passed to
+// fn before the error is returned.
+func eachRequestInOrder(list func(fn func(Request) error) error, compare func(a, b Request) int, fn func(Request) error) error {
+	var requests []Request
+	listErr := list(func(request Request) error {
+		requests = append(requests, request)
+		return nil
+	})
+
+	slices.SortStableFunc(requests, compare)
+	for _, request := range requests {
+		if err := fn(request); err != nil {
+			return err
+		}
+	}
+	return listErr
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxConsecutiveBadPages bounds how many failing pages in a row are skipped
+// before the listing is abandoned anyway.
+const maxConsecutiveBadPages = 3
+
+// Default retries of a failing request list page, on top of the retries of
+// each request.
+const (
+	defaultPageRetries   = 5
+	defaultPageBaseDelay = 5 * time.Second
+)
+
+// WithPageRetries sets how many more times EachRequest fetches a request list
+// page that failed after all request retries, and the base delay of the
+// exponential backoff between those attempts. Losing the listing loses every
+// record after it, so its backoff is longer than that of a single request.
+// Zero retries disables them.
+func WithPageRetries(maxRetries int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.pageRetries = maxRetries
+		c.pageBaseDelay = baseDelay
+	}
+}
+
+// retryablePageError reports whether fetching a request list page again may
+// succeed: rate limiting, server, timeout, and network errors are transient.
+func retryablePageError(err error) bool {
+	switch classifyError(err) {
+	case categoryRateLimit, categoryServer, categoryTimeout, categoryNetwork:
+		return true
+	}
+	return false
+}
+
+// getRequestsPage fetches the request list page at cursor, fetching it again
+// with jittered exponential backoff while it fails with a transient error.
+// Waiting stops as soon as the context is done.
+func (c *Client) getRequestsPage(ctx context.Context, cursor string) (*RequestListResponse, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.GetRequests(ctx, cursor)
+		if err == nil || attempt >= c.pageRetries || ctx.Err() != nil || !retryablePageError(err) {
+			return resp, err
+		}
+		delay := backoff(c.pageBaseDelay, attempt)
+		log.Printf("Fetching request list page %s failed, retrying in %s (%d/%d): %v",
+			c.pageLabel(cursor), delay.Round(time.Millisecond), attempt+1, c.pageRetries, err)
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WithSkipBadPages makes EachRequest skip a request list page that still fails
+// after all retries, instead of abandoning the remaining pages. Skipping needs a
+// page number in the cursor, and stops after maxConsecutiveBadPages failures in a row.
+func WithSkipBadPages() Option {
+	return func(c *Client) {
+		c.skipBadPages = true
+	}
+}
+
+// Pagination strategies of the request list: following the links.next href
+// given by the API, or counting pages or offsets in the query string for API
+// variants that do not give one.
+const (
+	paginationLinks  = "links"
+	paginationPage   = "page"
+	paginationOffset = "offset"
+)
+
+// WithPagination selects how EachRequest moves from one request list page to
+// the next: paginationLinks, the default, follows the links.next href of each
+// page; paginationPage increments a "page" query parameter and paginationOffset
+// advances an "offset" query parameter by the number of requests received. The
+// counting strategies stop at the first empty page. The strategy must have been
+// checked with checkPagination.
+func WithPagination(strategy string) Option {
+	return func(c *Client) {
+		c.pagination = strategy
+	}
+}
+
+// checkPagination validates a pagination strategy.
+func checkPagination(strategy string) error {
+	switch strategy {
+	case paginationLinks, paginationPage, paginationOffset:
+		return nil
+	}
+	return fmt.Errorf("unknown pagination strategy %q: must be %s, %s, or %s", strategy, paginationLinks, paginationPage, paginationOffset)
+}
+
+// nextCursor returns the cursor of the page after the one at cursor, given the
+// links.next href of that page and the number of requests it held, following
+// the pagination strategy. It returns "" after the last page.
+func (c *Client) nextCursor(cursor, linkNext string, n int) (string, error) {
+	switch c.pagination {
+	case paginationPage, paginationOffset:
+		if n == 0 {
+			return "", nil
+		}
+		param, step := "page", 1
+		if c.pagination == paginationOffset {
+			param, step = "offset", n
+		}
+		next, ok := advanceCursor(cursor, c.requestsListPath(), param, step)
+		if !ok {
+			return "", fmt.Errorf("cannot derive the next request list page from %s: invalid %s parameter", c.pageLabel(cursor), param)
+		}
+		return next, nil
+	}
+	return linkNext, nil
+}
+
+// nextPageCursor derives the cursor of the page after cursor by incrementing its
+// "page" query parameter; the empty cursor is page 1 of firstPage. It reports
+// false if the cursor carries no page number, in which case the next page is unknown.
+func nextPageCursor(cursor, firstPage string) (string, bool) {
+	return advanceCursor(cursor, firstPage, "page", 1)
+}
+
+// advanceCursor adds step to the numeric query parameter param of cursor; the
+// empty cursor is firstPage, where a missing page starts at 1 and a missing
+// offset at 0. It reports false if the cursor carries no number in param.
+func advanceCursor(cursor, firstPage, param string, step int) (string, bool) {
+	if cursor == "" {
+		cursor = firstPage
+	}
+	u, err := url.Parse(cursor)
+	if err != nil {
+		return "", false
+	}
+	query := u.Query()
+	if cursor == firstPage && !query.Has(param) {
+		start := "1"
+		if param == "offset" {
+			start = "0"
+		}
+		query.Set(param, start)
+	}
+	value, err := strconv.Atoi(query.Get(param))
+	if err != nil {
+		return "", false
+	}
+	query.Set(param, strconv.Itoa(value+step))
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
+
+// startCursor validates a request list cursor given by hand, such as with
+// -start-cursor, and normalizes it the way the links of API responses are: it
+// must be a path, or a URL on the API host, of a page of the request list.
+func (c *Client) startCursor(cursor string) (string, error) {
+	path, ok := c.linkPath(cursor)
+	if !ok {
+		return "", fmt.Errorf("invalid cursor %q: must be a path, or a URL on the API host, of a request list page", cursor)
+	}
+	u, err := url.Parse(path)
+	if err != nil || u.Path != c.endpoint(collectionPath, c.collection) {
+		return "", fmt.Errorf("invalid cursor %q: not a page of %s", cursor, c.endpoint(collectionPath, c.collection))
+	}
+	return path, nil
+}
+
+// pageLabel describes a cursor in log messages.
+func (c *Client) pageLabel(cursor string) string {
+	if cursor == "" {
+		return c.requestsListPath()
+	}
+	return cursor
+}
+
+// WithListFields asks the API to return only the given fields of each request in
+// list calls, reducing the size of large request lists. Fields left out decode
+// to their zero values. By default, all fields are returned.
+func WithListFields(fields []string) Option {
+	return func(c *Client) {
+		c.listFields = fields
+	}
+}
+
+// WithListQuery adds query parameters to the first request list call, for
+// server-side filters that the client does not wrap. They are sent as given,
+// URL-encoded, without any check; later pages follow the API's next links.
+func WithListQuery(query url.Values) Option {
+	return func(c *Client) {
+		c.listQuery = query
+	}
+}
+
+// requestsListPath returns the path of the first page of the request list,
+// with the field selection and the extra query parameters, if any.
+func (c *Client) requestsListPath() string {
+	var params []string
+	if len(c.listFields) > 0 {
+		params = append(params, "fields="+strings.Join(c.listFields, ","))
+	}
+	if len(c.listQuery) > 0 {
+		params = append(params, c.listQuery.Encode())
+	}
+	if len(params) == 0 {
+		return c.endpoint(collectionPath, c.collection)
+	}
+	return c.endpoint(collectionPath, c.collection) + "?" + strings.Join(params, "&")
+}
+
+// listFields validates the fields requested with -fields and adds the required
+// ones, keeping the order and dropping duplicates.
+func listFields(requested, required []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, field := range append(append([]string{}, requested...), required...) {
+		if field == "" || strings.TrimLeft(field, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			return nil, fmt.Errorf("invalid field %q: fields are lower-case names such as due_date", field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// eachRequestChunk walks up to maxPages pages of the request list, starting at
+// the cursor saved in the state by the previous chunk, and saves the cursor of
+// the next chunk. After a failure, the saved cursor is kept so that the next
+// run retries the whole chunk; records already synced are then skipped as unchanged.
+func eachRequestChunk(ctx context.Context, client *Client, state *stateStore, maxPages int, fn func(Request) error) error {
+	start := state.cursor()
+	if start != "" {
+		console.Printf("Continuing the request list at %s.\n", start)
+	}
+	next, err := client.EachRequestFrom(ctx, start, maxPages, fn)
+	if err != nil {
+		return err
+	}
+	state.setCursor(next)
+	if next == "" {
+		console.Printf("Reached the end of the request list; the next run starts over at the first page.\n")
+	} else {
+		console.Printf("Stopped after -max-pages %d; the next run continues at %s.\n", maxPages, next)
+	}
+	return nil
+}
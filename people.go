@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+)
+
+// peopleFileName is the name of the people index written to the output directory.
+const peopleFileName = "people.json"
+
+// PersonRoles lists the requests in which a person appears, grouped by role.
+type PersonRoles struct {
+	Person    PersonInfo `json:"person"`
+	Assignee  []int      `json:"assignee,omitempty"`
+	Requester []int      `json:"requester,omitempty"`
+	Reviewer  []int      `json:"reviewer,omitempty"`
+	Verifier  []int      `json:"verifier,omitempty"`
+}
+
+// peopleIndex aggregates the people of all processed requests. It is safe for
+// concurrent use by the workers.
+type peopleIndex struct {
+	mu     sync.Mutex
+	people map[int]*PersonRoles
+	seen   map[int]bool
+}
+
+// newPeopleIndex creates an empty people index.
+func newPeopleIndex() *peopleIndex {
+	return &peopleIndex{people: make(map[int]*PersonRoles), seen: make(map[int]bool)}
+}
+
+// add records every person referenced by the request under their role. A
+// request added again, as when its record is retried, is ignored.
+func (p *peopleIndex) add(request *Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.seen[request.ID] {
+		return
+	}
+	p.seen[request.ID] = true
+
+	for _, person := range request.Assignees {
+		p.entry(person).Assignee = append(p.entry(person).Assignee, request.ID)
+	}
+	for _, person := range request.Requesters {
+		p.entry(person).Requester = append(p.entry(person).Requester, request.ID)
+	}
+	for _, review := range request.Reviewers {
+		p.entry(review.Reviewer).Reviewer = append(p.entry(review.Reviewer).Reviewer, request.ID)
+	}
+	for _, person := range request.Verifiers {
+		p.entry(person).Verifier = append(p.entry(person).Verifier, request.ID)
+	}
+}
+
+// entry returns the roles of a person, creating them on first sight. The caller must hold the lock.
+func (p *peopleIndex) entry(person PersonInfo) *PersonRoles {
+	roles, ok := p.people[person.ID]
+	if !ok {
+		roles = &PersonRoles{Person: person}
+		p.people[person.ID] = roles
+	}
+	return roles
+}
+
+// write saves the index to path, with people and their request IDs sorted.
+func (p *peopleIndex) write(path string, mode os.FileMode) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	people := make([]*PersonRoles, 0, len(p.people))
+	for _, roles := range p.people {
+		for _, ids := range [][]int{roles.Assignee, roles.Requester, roles.Reviewer, roles.Verifier} {
+			sort.Ints(ids)
+		}
+		people = append(people, roles)
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].Person.ID < people[j].Person.ID })
+
+	data, err := json.MarshalIndent(people, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data, mode)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// redactor blanks out selected fields of request metadata before it leaves the
+// application. A field given as a plain name, such as "description", is blanked
+// at any depth; a dotted path, such as "assignees.name", is followed from the
+// top of the request, through arrays. Strings become "" and any other value
+// null. Only the fields of Request, as saved in metadata.json, can match.
+type redactor struct {
+	anywhere map[string]bool
+	paths    [][]string
+}
+
+// newRedactor creates a redactor for the given fields, or nil if there are none.
+func newRedactor(fields []string) *redactor {
+	if len(fields) == 0 {
+		return nil
+	}
+	r := &redactor{anywhere: make(map[string]bool)}
+	for _, field := range fields {
+		if strings.Contains(field, ".") {
+			r.paths = append(r.paths, strings.Split(field, "."))
+		} else {
+			r.anywhere[field] = true
+		}
+	}
+	return r
+}
+
+// request returns a redacted copy of req. The request goes through a generic
+// JSON representation, so that any field can be redacted; the copy is decoded
+// back so that the reports built from it are redacted too. A nil redactor
+// returns req unchanged.
+func (r *redactor) request(req *Request) (*Request, error) {
+	if r == nil {
+		return req, nil
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	r.redactAnywhere(doc)
+	for _, path := range r.paths {
+		redactPath(doc, path)
+	}
+
+	if data, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+	var redacted Request
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return nil, err
+	}
+	return &redacted, nil
+}
+
+// redactAnywhere blanks the fields matching a plain name in v and everything
+// nested in it.
+func (r *redactor) redactAnywhere(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if r.anywhere[key] {
+				v[key] = blank(value)
+			} else {
+				r.redactAnywhere(value)
+			}
+		}
+	case []any:
+		for _, value := range v {
+			r.redactAnywhere(value)
+		}
+	}
+}
+
+// redactPath blanks the field at path below v, applying the path to every
+// element of the arrays met on the way.
+func redactPath(v any, path []string) {
+	switch v := v.(type) {
+	case map[string]any:
+		value, ok := v[path[0]]
+		switch {
+		case !ok:
+		case len(path) == 1:
+			v[path[0]] = blank(value)
+		default:
+			redactPath(value, path[1:])
+		}
+	case []any:
+		for _, value := range v {
+			redactPath(value, path)
+		}
+	}
+}
+
+// blank returns the redacted replacement of a value: "" for a string, null otherwise.
+func blank(value any) any {
+	if _, ok := value.(string); ok {
+		return ""
+	}
+	return nil
+}
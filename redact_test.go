@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactorRequest(t *testing.T) {
+	description := "secret"
+	request := &Request{
+		ID:          7,
+		Title:       "Evidence",
+		Description: &description,
+		Assignees:   []PersonInfo{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}},
+		Audit:       AuditInfo{ID: 3, Title: "Audit", Type: "Audit"},
+	}
+
+	redacted, err := newRedactor([]string{"description", "assignees.name", "title"}).request(request)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if redacted.GetDescription() != "" {
+		t.Errorf("description = %q, want it blanked", redacted.GetDescription())
+	}
+	for _, assignee := range redacted.Assignees {
+		if assignee.Name != "" || assignee.ID == 0 {
+			t.Errorf("assignee = %+v, want only its name blanked", assignee)
+		}
+	}
+	if redacted.Title != "" || redacted.Audit.Title != "" {
+		t.Errorf("titles = %q, %q, want them blanked at any depth", redacted.Title, redacted.Audit.Title)
+	}
+	if redacted.ID != 7 || redacted.Audit.ID != 3 {
+		t.Errorf("IDs = %d, %d, want them kept", redacted.ID, redacted.Audit.ID)
+	}
+
+	// The request redacted from is left as it was.
+	if request.GetDescription() != "secret" || request.Title != "Evidence" || request.Assignees[0].Name != "Alice" {
+		t.Errorf("original request was modified: %+v", request)
+	}
+
+	var none *redactor
+	if got, err := none.request(request); err != nil || got != request {
+		t.Errorf("nil redactor returned %p, %v; want the request itself", got, err)
+	}
+}
+
+func TestSaveMetadataRedactsOnlyTheSavedCopy(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 7, "title": "Evidence", "description": "secret",
+			"links": {"attachments": {"href": "/api/v2/requests/7/files"}}}`))
+	}))
+	dir := t.TempDir()
+
+	redact := newRedactor([]string{"id", "links", "description"})
+	details, redacted, err := saveMetadata(context.Background(), client, 7, dir, 0o600, redact)
+	if err != nil {
+		t.Fatalf("saveMetadata: %v", err)
+	}
+
+	// The details used for further API calls are as returned.
+	if details.ID != 7 || details.Links.Href(attachmentsRel) != "/api/v2/requests/7/files" || details.GetDescription() != "secret" {
+		t.Errorf("details = %+v, want them unredacted", details)
+	}
+	if redacted.ID != 0 || len(redacted.Links) != 0 || redacted.GetDescription() != "" {
+		t.Errorf("redacted = %+v, want id, links, and description blanked", redacted)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]any
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if links, _ := saved["links"].(map[string]any); saved["description"] != "" || saved["id"] != float64(0) || len(links) != 0 {
+		t.Errorf("metadata.json = %s, want id, links, and description blanked", data)
+	}
+	if saved["title"] != "Evidence" {
+		t.Errorf("metadata.json title = %v, want it kept", saved["title"])
+	}
+}
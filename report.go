@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+// reportTemplate renders the HTML run report. It is a single page with inline styles
+// so that it can be opened and shared without any other files.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ZenGRC export report - {{.StartedAt}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; margin-top: 0.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f2f2f2; }
+td.num { text-align: right; }
+.complete { color: #1a7f37; }
+.incomplete { color: #9a6700; }
+.failed { color: #cf222e; font-weight: bold; }
+.meta { color: #555; }
+</style>
+</head>
+<body>
+<h1>ZenGRC export report</h1>
+<p class="meta">Exported {{.Mode}} with zengrc {{.Version}} ({{.Commit}}), started {{.StartedAt}}, finished {{.FinishedAt}}.</p>
+
+<h2>Totals</h2>
+<table>
+<tr><th>Records</th><td class="num">{{.Summary.Records}}</td></tr>
+<tr><th>Complete</th><td class="num">{{.Summary.RecordsComplete}}</td></tr>
+<tr><th>Failed</th><td class="num">{{.Summary.RecordsFailed}}</td></tr>
+<tr><th>Without attachments</th><td class="num">{{.Summary.RecordsWithoutAttachments}}</td></tr>
+<tr><th>Unchanged since the last sync</th><td class="num">{{.Summary.RecordsUnchanged}}</td></tr>
+<tr><th>Attachments downloaded</th><td class="num">{{.Summary.AttachmentsDownloaded}} ({{.Bytes}})</td></tr>
+<tr><th>Attachments already present</th><td class="num">{{.Summary.AttachmentsExisting}}</td></tr>
+<tr><th>Attachments reused from the global index</th><td class="num">{{.Summary.AttachmentsReused}}</td></tr>
+<tr><th>Attachments failed</th><td class="num">{{.Summary.AttachmentsFailed}}</td></tr>
+<tr><th>Retries</th><td class="num">{{.Summary.Retries}}</td></tr>
+<tr><th>Issues</th><td class="num">{{.Summary.Issues}}</td></tr>
+<tr><th>Duration</th><td class="num">{{.Duration}}</td></tr>
+</table>
+
+{{if .Failures}}
+<h2>Failures</h2>
+<table>
+<tr><th>Record</th><th>Attachment</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{.RecordID}}</td><td>{{.Name}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Records</h2>
+<table>
+<tr><th>ID</th><th>Title</th><th>Type</th><th>Status</th><th>Downloaded</th><th>Present</th><th>Failed</th></tr>
+{{range .Records}}<tr><td>{{.ID}}</td><td>{{.Title}}</td><td>{{.Type}}</td><td class="{{.Status}}">{{.Status}}</td><td class="num">{{.Downloaded}}</td><td class="num">{{.Existing}}</td><td class="num">{{.Failed}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// reportRecord is a row of the records table of the HTML report.
+type reportRecord struct {
+	ID         int
+	Title      string
+	Type       string
+	Status     string
+	Downloaded int
+	Existing   int
+	Failed     int
+}
+
+// reportFailure is a row of the failures table of the HTML report. Name is empty
+// when the whole record failed.
+type reportFailure struct {
+	RecordID int
+	Name     string
+	Error    string
+}
+
+// reportData is the data rendered by reportTemplate.
+type reportData struct {
+	Mode       string
+	Version    string
+	Commit     string
+	StartedAt  string
+	FinishedAt string
+	Duration   string
+	Bytes      string
+	Summary    Summary
+	Records    []reportRecord
+	Failures   []reportFailure
+}
+
+// writeHTMLReport renders the records collected so far and the run summary as a
+// self-contained HTML page and saves it to path.
+func (m *manifestRecorder) writeHTMLReport(path, mode string, summary Summary, fileMode os.FileMode) error {
+	m.mu.Lock()
+	data := reportData{
+		Mode:       mode,
+		Version:    m.manifest.Version,
+		Commit:     m.manifest.Commit,
+		StartedAt:  m.started.UTC().Format(time.RFC3339),
+		FinishedAt: time.Now().UTC().Format(time.RFC3339),
+		Duration:   time.Duration(summary.DurationSeconds * float64(time.Second)).String(),
+		Bytes:      formatBytes(summary.BytesDownloaded),
+		Summary:    summary,
+	}
+	records := append([]RecordResult(nil), m.manifest.Records...)
+	m.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	for _, record := range records {
+		row := reportRecord{ID: record.ID, Title: record.Title, Type: record.Type}
+		switch {
+		case record.Error != "":
+			row.Status = "failed"
+			data.Failures = append(data.Failures, reportFailure{RecordID: record.ID, Error: record.Error})
+		case record.Complete:
+			row.Status = "complete"
+		default:
+			row.Status = "incomplete"
+		}
+		for _, attachment := range record.Attachments {
+			switch attachment.Status {
+			case attachmentDownloaded:
+				row.Downloaded++
+			case attachmentExisting, attachmentReused:
+				row.Existing++
+			case attachmentFailed:
+				row.Failed++
+				data.Failures = append(data.Failures, reportFailure{RecordID: record.ID, Name: attachment.Name, Error: attachment.Error})
+			}
+		}
+		data.Records = append(data.Records, row)
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes(), fileMode)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default retry and circuit breaker settings.
+const (
+	defaultMaxRetries       = 3
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+	maxRetryDelay           = 30 * time.Second
+	defaultBreakerThreshold = 10
+	defaultBreakerCooldown  = 30 * time.Second
+	breakerPollInterval     = 100 * time.Millisecond
+)
+
+// WithRetries sets how many times a failed request is retried and the base
+// delay of the exponential backoff between attempts. Zero retries disables retrying.
+func WithRetries(maxRetries int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBaseDelay = baseDelay
+	}
+}
+
+// WithRetryBudget caps the total number of retries across all requests of the
+// clients created with this option, which share a single budget, as do the
+// tenants of an -all-tenants run. Once the budget is spent, failing requests
+// are no longer retried. Zero, the default, leaves the total unlimited.
+func WithRetryBudget(maxTotalRetries int) Option {
+	budget := &retryBudget{limit: int64(maxTotalRetries)}
+	return func(c *Client) {
+		c.retries = budget
+	}
+}
+
+// WithCircuitBreaker pauses all requests for cooldown once threshold consecutive
+// requests have failed. A threshold of zero disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	}
+}
+
+// send executes req, retrying network errors, 429s, and 5xx responses with
+// jittered exponential backoff. Every attempt first passes the circuit breaker.
+// The response of the final attempt is returned as is. Waiting stops as soon as
+// the request's context is done.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		probe, err := c.breaker.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// A request that was never sent, or whose context ended, says nothing
+		// about the API: it neither counts for the breaker nor spends the retry
+		// budget, and its probe, if any, is handed back.
+		resp, err := c.httpClientFor(req).Do(req)
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			c.breaker.release(probe)
+			return nil, authErr.err
+		}
+		if ctx.Err() != nil {
+			c.breaker.release(probe)
+			return resp, err
+		}
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		c.breaker.record(!retryable)
+		if !retryable || attempt >= c.maxRetries || !c.takeRetry() {
+			return resp, err
+		}
+
+		// Drain and close the failed response so that its connection can be reused.
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		if err := c.sleep(ctx, backoff(c.retryBaseDelay, attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryBudget counts the retries made by the clients sharing it and enforces an
+// optional limit on their total.
+type retryBudget struct {
+	limit     int64
+	used      atomic.Int64
+	exhausted atomic.Bool
+}
+
+// take spends one retry, reporting false if the budget is exhausted.
+func (b *retryBudget) take() bool {
+	if n := b.used.Add(1); b.limit > 0 && n > b.limit {
+		b.used.Add(-1)
+		if b.exhausted.CompareAndSwap(false, true) {
+			log.Printf("Retry budget of %d exhausted: failing requests are no longer retried", b.limit)
+		}
+		return false
+	}
+	return true
+}
+
+// takeRetry spends one retry of the client's budget, reporting false if the
+// budget is exhausted.
+func (c *Client) takeRetry() bool {
+	if !c.retries.take() {
+		return false
+	}
+	c.retried.Add(1)
+	return true
+}
+
+// retryStats returns the number of retries made so far by the client and
+// whether the retry budget, which may be shared with other clients, ran out.
+func (c *Client) retryStats() (retries int, exhausted bool) {
+	return int(c.retried.Load()), c.retries.exhausted.Load()
+}
+
+// backoff returns the delay before retry attempt+1: a random duration up to
+// base*2^attempt ("full jitter"), capped at maxRetryDelay.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return rand.N(d) + 1
+}
+
+// circuitBreaker stops all requests for a cooldown period after too many
+// consecutive failures, then lets a single probe request through. The breaker
+// closes again if the probe succeeds and reopens if it fails. A nil breaker
+// never trips.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     Clock
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// wait blocks while the breaker is open or while another request is probing,
+// or until the context is done. It reports whether the request is the probe.
+func (b *circuitBreaker) wait(ctx context.Context) (probe bool, err error) {
+	if b == nil || b.threshold <= 0 {
+		return false, nil
+	}
+	for {
+		b.mu.Lock()
+		var d time.Duration
+		switch {
+		case b.failures < b.threshold:
+			b.mu.Unlock()
+			return false, nil
+		case b.clock.Now().Before(b.openUntil):
+			d = b.openUntil.Sub(b.clock.Now())
+		case !b.probing:
+			b.probing = true // This request is the probe.
+			b.mu.Unlock()
+			return true, nil
+		default:
+			d = breakerPollInterval
+		}
+		b.mu.Unlock()
+		if err := sleepOn(ctx, b.clock, d); err != nil {
+			return false, err
+		}
+	}
+}
+
+// release lets another request probe when the probe ended without an outcome
+// to record. It does nothing for a request that was not the probe.
+func (b *circuitBreaker) release(probe bool) {
+	if b == nil || !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record updates the breaker with the outcome of a request.
+func (b *circuitBreaker) record(success bool) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		if b.failures >= b.threshold {
+			log.Printf("Circuit breaker closed: API is responding again")
+		}
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.probing = false
+		b.openUntil = b.clock.Now().Add(b.cooldown)
+		log.Printf("Circuit breaker open after %d consecutive failures: pausing requests for %s", b.failures, b.cooldown)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt, limit := range []time.Duration{base, 2 * base, 4 * base, 8 * base} {
+		for range 100 {
+			if d := backoff(base, attempt); d <= 0 || d > limit {
+				t.Fatalf("backoff(%s, %d) = %s, want within (0, %s]", base, attempt, d, limit)
+			}
+		}
+	}
+
+	// Delays are capped, including when the shift overflows.
+	for _, attempt := range []int{20, 70} {
+		if d := backoff(base, attempt); d <= 0 || d > maxRetryDelay {
+			t.Errorf("backoff(%s, %d) = %s, want within (0, %s]", base, attempt, d, maxRetryDelay)
+		}
+	}
+}
+
+func TestSendRetryWaits(t *testing.T) {
+	clock := newFakeClock()
+	calls := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id": 1}`)
+	}), WithRetries(3, time.Second), WithClock(clock), WithCircuitBreaker(0, 0))
+
+	if _, err := client.GetRequestDetails(context.Background(), 1); err != nil {
+		t.Fatalf("GetRequestDetails: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("server called %d times, want 3", calls)
+	}
+	waits := clock.recorded()
+	if len(waits) != 2 {
+		t.Fatalf("waits = %v, want 2", waits)
+	}
+	for attempt, d := range waits {
+		if limit := time.Second << attempt; d <= 0 || d > limit {
+			t.Errorf("wait %d = %s, want within (0, %s]", attempt+1, d, limit)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := newFakeClock()
+	b := &circuitBreaker{threshold: 2, cooldown: time.Minute, clock: clock}
+	ctx := context.Background()
+
+	// Below the threshold, requests pass without waiting.
+	b.record(false)
+	if probe, err := b.wait(ctx); err != nil || probe || len(clock.recorded()) != 0 {
+		t.Fatalf("wait below the threshold = %t, %v after waits %v, want no wait", probe, err, clock.recorded())
+	}
+
+	// Once open, the breaker holds requests for the rest of the cooldown, then
+	// lets the probe through.
+	b.record(false)
+	clock.advance(20 * time.Second)
+	if probe, err := b.wait(ctx); err != nil || !probe {
+		t.Fatalf("wait once open = %t, %v; want the probe", probe, err)
+	}
+	if waits := clock.recorded(); len(waits) != 1 || waits[0] != 40*time.Second {
+		t.Fatalf("waits = %v, want [40s]", waits)
+	}
+
+	// A probe released without an outcome lets the next request probe at once.
+	b.release(true)
+	if probe, err := b.wait(ctx); err != nil || !probe || len(clock.recorded()) != 1 {
+		t.Fatalf("wait after a released probe = %t, %v after waits %v, want the probe without waiting", probe, err, clock.recorded())
+	}
+
+	// A failed probe reopens the breaker for a full cooldown.
+	b.record(false)
+	if _, err := b.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if waits := clock.recorded(); len(waits) != 2 || waits[1] != time.Minute {
+		t.Fatalf("waits = %v, want a second wait of 1m", waits)
+	}
+
+	// A successful probe closes it.
+	b.record(true)
+	if probe, err := b.wait(ctx); err != nil || probe || len(clock.recorded()) != 2 {
+		t.Fatalf("wait once closed = %t, %v after waits %v, want no wait", probe, err, clock.recorded())
+	}
+}
+
+// openBreaker returns a breaker whose cooldown is over, so that the next
+// request is its probe.
+func openBreaker(clock Clock) *circuitBreaker {
+	return &circuitBreaker{threshold: 1, cooldown: time.Minute, clock: clock, failures: 1, openUntil: clock.Now()}
+}
+
+func TestSendWithoutOutcome(t *testing.T) {
+	t.Run("cancelled", func(t *testing.T) {
+		clock := newFakeClock()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			<-r.Context().Done()
+		}), WithRetries(3, time.Second), WithClock(clock))
+		client.breaker = openBreaker(clock)
+
+		if _, err := client.GetRequestDetails(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Fatalf("GetRequestDetails = %v, want %v", err, context.Canceled)
+		}
+		if retries, _ := client.retryStats(); retries != 0 {
+			t.Errorf("retries = %d, want none spent on a cancelled request", retries)
+		}
+		if client.breaker.failures != 1 || client.breaker.probing {
+			t.Errorf("breaker failures = %d, probing %t; want 1 and the probe released", client.breaker.failures, client.breaker.probing)
+		}
+	})
+
+	t.Run("auth error", func(t *testing.T) {
+		clock := newFakeClock()
+		client := newTestClient(t, http.NotFoundHandler(), WithClock(clock),
+			WithTokenProvider(func(ctx context.Context) (string, error) { return "", errors.New("no token") }))
+		client.breaker = openBreaker(clock)
+
+		if _, err := client.GetRequestDetails(context.Background(), 1); err == nil {
+			t.Fatal("GetRequestDetails succeeded, want the token error")
+		}
+		if client.breaker.failures != 1 || client.breaker.probing {
+			t.Errorf("breaker failures = %d, probing %t; want 1 and the probe released", client.breaker.failures, client.breaker.probing)
+		}
+	})
+}
+
+func TestRetryBudgetShared(t *testing.T) {
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	budget := WithRetryBudget(3)
+	first := newTestClient(t, failing, WithRetries(2, time.Second), WithClock(newFakeClock()), WithCircuitBreaker(0, 0), budget)
+	second := newTestClient(t, failing, WithRetries(2, time.Second), WithClock(newFakeClock()), WithCircuitBreaker(0, 0), budget)
+	ctx := context.Background()
+
+	// The first client spends 2 retries, leaving 1 to the second.
+	if _, err := first.GetRequestDetails(ctx, 1); err == nil {
+		t.Fatal("GetRequestDetails succeeded, want an error")
+	}
+	if retries, exhausted := first.retryStats(); retries != 2 || exhausted {
+		t.Errorf("first client: %d retries, exhausted %t; want 2 and budget left", retries, exhausted)
+	}
+	if _, err := second.GetRequestDetails(ctx, 1); err == nil {
+		t.Fatal("GetRequestDetails succeeded, want an error")
+	}
+	if retries, exhausted := second.retryStats(); retries != 1 || !exhausted {
+		t.Errorf("second client: %d retries, exhausted %t; want 1 and the shared budget exhausted", retries, exhausted)
+	}
+}
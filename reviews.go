@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// reviewsFileName is the name of the review status report written to the output directory.
+const reviewsFileName = "reviews.csv"
+
+// Aggregate review states of a request.
+const (
+	reviewApproved    = "approved"
+	reviewPending     = "pending"
+	reviewNoReviewers = "no reviewers"
+)
+
+// reviewReport collects the reviewers of all processed requests. It is safe for
+// concurrent use by the workers.
+type reviewReport struct {
+	mu       sync.Mutex
+	requests []*Request
+	seen     map[int]bool
+}
+
+// newReviewReport creates an empty review report.
+func newReviewReport() *reviewReport {
+	return &reviewReport{seen: make(map[int]bool)}
+}
+
+// add records the reviewers of a request. A request added again, as when its
+// record is retried, is ignored.
+func (r *reviewReport) add(request *Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[request.ID] {
+		return
+	}
+	r.seen[request.ID] = true
+	r.requests = append(r.requests, &Request{ID: request.ID, Title: request.Title, Reviewers: request.Reviewers})
+}
+
+// reviewState returns the aggregate review state of a request: approved once
+// every reviewer has approved, pending otherwise.
+func reviewState(reviewers []ReviewerStatus) string {
+	if len(reviewers) == 0 {
+		return reviewNoReviewers
+	}
+	for _, reviewer := range reviewers {
+		if !strings.EqualFold(reviewer.Status, reviewApproved) {
+			return reviewPending
+		}
+	}
+	return reviewApproved
+}
+
+// write saves the report to path as CSV, with one row per reviewer of each
+// request, sorted by request ID. Requests without reviewers get a single row.
+func (r *reviewReport) write(path string, mode os.FileMode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Slice(r.requests, func(i, j int) bool { return r.requests[i].ID < r.requests[j].ID })
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"request_id", "request_title", "reviewer_id", "reviewer_name", "reviewer_status", "request_review_state"})
+	for _, request := range r.requests {
+		id, state := strconv.Itoa(request.ID), reviewState(request.Reviewers)
+		if len(request.Reviewers) == 0 {
+			_ = w.Write([]string{id, request.Title, "", "", "", state})
+		}
+		for _, reviewer := range request.Reviewers {
+			_ = w.Write([]string{id, request.Title, strconv.Itoa(reviewer.Reviewer.ID), reviewer.Reviewer.Name, reviewer.Status, state})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeFile(path, buf.Bytes(), mode)
+}
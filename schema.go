@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// schemaJSON describes the API responses that the client decodes, after the
+// swagger specification that the data structures follow. It holds one schema
+// per response in its definitions.
+//
+//go:embed schema.json
+var schemaJSON []byte
+
+// Schemas of the responses checked with WithSchemaValidation.
+const (
+	schemaRequestList    = "request_list"
+	schemaRequest        = "request"
+	schemaAttachmentList = "attachment_list"
+)
+
+// WithSchemaValidation checks the request list, request details, and attachment
+// list responses against the embedded schema, to surface API changes that would
+// otherwise decode silently to zero values. Each distinct mismatch is logged
+// once as a warning; with strict, a mismatching response also fails the call.
+// The schema describes requests, not assessments.
+func WithSchemaValidation(strict bool) Option {
+	return func(c *Client) {
+		c.schema = newSchemaValidator(strict)
+	}
+}
+
+// jsonSchema is the subset of JSON Schema used by the embedded schema: types,
+// object properties, required properties, additional properties, array items,
+// and references to definitions.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+}
+
+// schemaTypes is the type of a schema, a single type name or a list of them.
+type schemaTypes []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// additionalProperties is false, forbidding properties that are not listed, or
+// the schema of the properties that are not listed.
+type additionalProperties struct {
+	forbidden bool
+	schema    *jsonSchema
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *additionalProperties) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.forbidden = !allowed
+		return nil
+	}
+	return json.Unmarshal(data, &a.schema)
+}
+
+// schemaValidator checks responses against the embedded schema and logs each
+// distinct mismatch once. It is safe for concurrent use.
+type schemaValidator struct {
+	root   *jsonSchema
+	strict bool
+
+	mu     sync.Mutex
+	logged map[string]bool
+}
+
+// newSchemaValidator parses the embedded schema.
+func newSchemaValidator(strict bool) *schemaValidator {
+	var root jsonSchema
+	if err := json.Unmarshal(schemaJSON, &root); err != nil {
+		panic(fmt.Sprintf("invalid embedded schema: %v", err))
+	}
+	return &schemaValidator{root: &root, strict: strict, logged: make(map[string]bool)}
+}
+
+// check validates a response body against the named schema. It logs the
+// mismatches not seen before and, if strict, returns them as an error.
+func (v *schemaValidator) check(name, path string, body []byte) error {
+	return v.checkAt(name, name, path, body)
+}
+
+// checkAt is check for a part of a response, such as one request of a list
+// decoded on its own, whose mismatches are located from at.
+func (v *schemaValidator) checkAt(name, at, path string, body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil // Left to the decoding of the response to report.
+	}
+
+	var problems []string
+	v.validate(v.root.Definitions[name], value, at, &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+
+	v.mu.Lock()
+	for _, problem := range problems {
+		if !v.logged[problem] {
+			v.logged[problem] = true
+			log.Printf("Warning: API response does not match the schema: %s (first seen in %s)", problem, path)
+		}
+	}
+	v.mu.Unlock()
+
+	if v.strict {
+		return fmt.Errorf("response of %s does not match the schema: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validate appends the mismatches between value and schema to problems. Array
+// indexes are left out of the locations, so that the same mismatch in several
+// items is reported once.
+func (v *schemaValidator) validate(schema *jsonSchema, value any, at string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref != "" {
+		v.validate(v.root.Definitions[strings.TrimPrefix(schema.Ref, "#/definitions/")], value, at, problems)
+		return
+	}
+
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		*problems = append(*problems, fmt.Sprintf("%s is %s, expected %s", at, jsonTypeOf(value), strings.Join(schema.Type, " or ")))
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%s is missing", at, name))
+			}
+		}
+		for name, member := range value {
+			if property, ok := schema.Properties[name]; ok {
+				v.validate(property, member, at+"."+name, problems)
+				continue
+			}
+			switch additional := schema.AdditionalProperties; {
+			case additional == nil:
+			case additional.forbidden:
+				*problems = append(*problems, fmt.Sprintf("%s.%s is not an expected field", at, name))
+			default:
+				v.validate(additional.schema, member, at+".*", problems)
+			}
+		}
+	case []any:
+		for _, item := range value {
+			v.validate(schema.Items, item, at+"[]", problems)
+		}
+	}
+}
+
+// matchesType reports whether value is of one of the JSON Schema types.
+func matchesType(types schemaTypes, value any) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf returns the JSON Schema type of a value decoded with UseNumber.
+func jsonTypeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+// doChecked is do, checking the response body against the named schema first
+// when schema validation is enabled.
+func (c *Client) doChecked(name string, req *http.Request, v any) error {
+	if c.schema == nil {
+		return c.do(req, v)
+	}
+	var body rawResponse
+	if err := c.do(req, &body); err != nil {
+		return err
+	}
+	if len(body.data) == 0 {
+		return nil // An empty result, as with do.
+	}
+	if err := c.schema.check(name, req.URL.Path, body.data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body.data, v); err != nil {
+		return err
+	}
+	if e, ok := v.(etagged); ok {
+		e.setETag(body.etag)
+	}
+	return nil
+}
+
+// rawResponse is a response body kept as it is, with its ETag header.
+type rawResponse struct {
+	data json.RawMessage
+	etag string
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *rawResponse) UnmarshalJSON(data []byte) error {
+	r.data = append(r.data[:0], data...)
+	return nil
+}
+
+// setETag implements etagged.
+func (r *rawResponse) setETag(etag string) { r.etag = etag }
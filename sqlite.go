@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// sqliteDriver is the database/sql driver of -sqlite. Only builds with the
+// sqlite tag register it (sqlite_driver.go), so that the default build does not
+// depend on a SQLite implementation.
+const sqliteDriver = "sqlite"
+
+// sqliteBufferSize is how many records can be queued for the SQLite index
+// before the workers wait for its writer.
+const sqliteBufferSize = 256
+
+// errNoSQLite is returned when -sqlite is used with a build without SQLite support.
+var errNoSQLite = errors.New("this build has no SQLite support; rebuild it with -tags sqlite")
+
+// sqliteSchema creates the tables of the SQLite index. A record exported again,
+// by a later pass or run, replaces its row and its attachments.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS requests (
+		id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL,
+		code TEXT,
+		type TEXT,
+		status TEXT,
+		due_date TEXT,
+		created_at TEXT,
+		updated_at TEXT,
+		dir TEXT,
+		complete INTEGER NOT NULL,
+		metadata_saved INTEGER NOT NULL,
+		error TEXT,
+		exported_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS attachments (
+		request_id INTEGER NOT NULL REFERENCES requests (id),
+		document_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		uploaded_at TEXT,
+		bytes INTEGER,
+		sha256 TEXT,
+		status TEXT NOT NULL,
+		error TEXT,
+		PRIMARY KEY (request_id, path)
+	)`,
+	`CREATE INDEX IF NOT EXISTS attachments_document_id ON attachments (document_id)`,
+	`CREATE INDEX IF NOT EXISTS attachments_sha256 ON attachments (sha256)`,
+}
+
+// sqliteRecord is a processed record queued for the SQLite index, with the
+// request it was processed from.
+type sqliteRecord struct {
+	request Request
+	result  RecordResult
+}
+
+// sqliteIndex writes the records and attachments of a run into a SQLite
+// database as they are processed. The workers queue records on a channel and a
+// single goroutine writes them over a single connection, one transaction per
+// batch of queued records.
+type sqliteIndex struct {
+	db      *sql.DB
+	records chan sqliteRecord
+	done    chan error
+}
+
+// sqliteAvailable reports whether this build can write a SQLite index.
+func sqliteAvailable() bool {
+	return slices.Contains(sql.Drivers(), sqliteDriver)
+}
+
+// openSQLiteIndex opens or creates the SQLite database at path, creates its
+// tables if needed, and starts its writer goroutine.
+func openSQLiteIndex(path string) (*sqliteIndex, error) {
+	if !sqliteAvailable() {
+		return nil, errNoSQLite
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("creating tables: %w", err)
+		}
+	}
+
+	s := &sqliteIndex{
+		db:      db,
+		records: make(chan sqliteRecord, sqliteBufferSize),
+		done:    make(chan error, 1),
+	}
+	go s.run()
+	return s, nil
+}
+
+// add queues a processed record. It is safe for concurrent use.
+func (s *sqliteIndex) add(request Request, result RecordResult) {
+	s.records <- sqliteRecord{request: request, result: result}
+}
+
+// close writes all queued records and closes the database. It returns the
+// first write error, already logged when it occurred.
+func (s *sqliteIndex) close() error {
+	close(s.records)
+	return <-s.done
+}
+
+// run writes queued records until the channel is closed, taking whatever else
+// is queued along with each record into the same transaction. A batch that
+// fails is logged and the writer moves on to the next one.
+func (s *sqliteIndex) run() {
+	var firstErr error
+	batch := make([]sqliteRecord, 0, sqliteBufferSize)
+	for record := range s.records {
+		batch = append(batch[:0], record)
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case record, ok := <-s.records:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, record)
+			default:
+				break drain
+			}
+		}
+		if err := s.write(batch); err != nil {
+			log.Printf("Error writing %d records to the SQLite index: %v", len(batch), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	s.done <- errors.Join(firstErr, s.db.Close())
+}
+
+// write replaces the rows of a batch of records in a single transaction.
+func (s *sqliteIndex) write(batch []sqliteRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op once committed.
+	}()
+
+	exportedAt := time.Now().UTC().Format(time.RFC3339)
+	for _, record := range batch {
+		request, result := record.request, record.result
+		if _, err := tx.Exec(`DELETE FROM attachments WHERE request_id = ?`, result.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO requests
+			(id, title, code, type, status, due_date, created_at, updated_at, dir, complete, metadata_saved, error, exported_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			result.ID, result.Title, request.Code, result.Type, request.Status, request.DueDate, request.CreatedAt,
+			request.UpdatedAt, result.Dir, result.Complete, result.MetadataSaved, result.Error, exportedAt); err != nil {
+			return err
+		}
+		for _, attachment := range result.Attachments {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO attachments
+				(request_id, document_id, name, path, uploaded_at, bytes, sha256, status, error)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				result.ID, attachment.DocumentID, attachment.Name, attachment.Path, attachment.UploadedAt,
+				attachment.Bytes, attachment.SHA256, attachment.Status, attachment.Error); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
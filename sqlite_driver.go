@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// Register the pure-Go SQLite driver used by -sqlite.
+import _ "modernc.org/sqlite"
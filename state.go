@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// stateVersion is the version of the state file format written by this build.
+const stateVersion = 1
+
+// stateFileName is the default name of the state file in the output directory.
+const stateFileName = "state.json"
+
+// State is the persisted incremental sync state. Its JSON form is:
+//
+//	{"version":1,"records":{"<id>":{"updated_at":"...","etag":"...","attachments_uploaded_at":"..."}},"cursor":"...","last_run":"..."}
+//
+// Cursor is the request list page at which the next -max-pages run continues,
+// and LastRun the start time of the last fully successful -since-last-run run.
+type State struct {
+	Version int                    `json:"version"`
+	Records map[string]RecordState `json:"records"`
+	Cursor  string                 `json:"cursor,omitempty"`
+	LastRun string                 `json:"last_run,omitempty"`
+}
+
+// RecordState is what is remembered about a record that was fully synced.
+type RecordState struct {
+	UpdatedAt string `json:"updated_at"`
+	ETag      string `json:"etag,omitempty"`
+	// AttachmentsUploadedAt is the watermark of -only-new-attachments: the
+	// upload time of the most recent attachment of the record.
+	AttachmentsUploadedAt string `json:"attachments_uploaded_at,omitempty"`
+}
+
+// stateStore holds the sync state of a run. It is safe for concurrent use.
+type stateStore struct {
+	mu    sync.Mutex
+	path  string
+	state State
+	// readOnly is set when the file on disk was written by a newer version,
+	// so that it is left untouched rather than downgraded.
+	readOnly bool
+}
+
+// loadState reads the state file at path. A missing file starts an empty state.
+// A corrupt file or one with an unknown version is reported with a warning and
+// also starts an empty state, which makes the run a full sync.
+func loadState(path string) *stateStore {
+	s := &stateStore{path: path, state: State{Version: stateVersion, Records: map[string]RecordState{}}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s
+	}
+	if err != nil {
+		log.Printf("Warning: cannot read state file %s, doing a full sync: %v", path, err)
+		return s
+	}
+
+	var state State
+	switch err := json.Unmarshal(data, &state); {
+	case err != nil:
+		log.Printf("Warning: state file %s is corrupt, doing a full sync: %v", path, err)
+	case state.Version > stateVersion:
+		log.Printf("Warning: state file %s has version %d, newer than the supported version %d; doing a full sync and leaving it untouched", path, state.Version, stateVersion)
+		s.readOnly = true
+	case state.Version < 1:
+		log.Printf("Warning: state file %s has no valid version, doing a full sync", path)
+	default:
+		if state.Records != nil {
+			s.state.Records = state.Records
+		}
+		s.state.Cursor = state.Cursor
+		s.state.LastRun = state.LastRun
+	}
+	return s
+}
+
+// unchanged reports whether the request was fully synced before and has not
+// been updated since.
+func (s *stateStore) unchanged(request Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.state.Records[strconv.Itoa(request.ID)]
+	return ok && request.UpdatedAt != "" && record.UpdatedAt == request.UpdatedAt
+}
+
+// update remembers that the request was fully synced at its current version,
+// with the ETag of its details, and attachments uploaded up to uploadedAt. The
+// ETag stored before is kept when the details came without one, or were not
+// fetched; the attachments watermark never moves back.
+func (s *stateStore) update(request Request, etag, uploadedAt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strconv.Itoa(request.ID)
+	previous := s.state.Records[key]
+	if etag == "" {
+		etag = previous.ETag
+	}
+	watermark := previous.AttachmentsUploadedAt
+	if uploadedAt != "" && (watermark == "" || uploadedAfter(File{UploadedAt: uploadedAt}, File{UploadedAt: watermark})) {
+		watermark = uploadedAt
+	}
+	s.state.Records[key] = RecordState{UpdatedAt: request.UpdatedAt, ETag: etag, AttachmentsUploadedAt: watermark}
+}
+
+// watermark returns the upload time of the most recent attachment of the
+// request synced so far, reporting false if it is unknown.
+func (s *stateStore) watermark(requestID int) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := time.Parse(time.RFC3339, s.state.Records[strconv.Itoa(requestID)].AttachmentsUploadedAt)
+	return t, err == nil
+}
+
+// cursor returns the request list page at which the previous chunked run
+// stopped, or "" to start at the first page.
+func (s *stateStore) cursor() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Cursor
+}
+
+// setCursor remembers the request list page at which the next chunked run
+// continues; "" starts it over at the first page.
+func (s *stateStore) setCursor(cursor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Cursor = cursor
+}
+
+// lastRun returns the start time of the last fully successful run, reporting
+// false if there is none.
+func (s *stateStore) lastRun() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := time.Parse(time.RFC3339, s.state.LastRun)
+	return t, err == nil
+}
+
+// setLastRun remembers the start time of a fully successful run.
+func (s *stateStore) setLastRun(started time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.LastRun = started.UTC().Format(time.RFC3339)
+}
+
+// save atomically writes the state file, unless it belongs to a newer version.
+func (s *stateStore) save(mode os.FileMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, mode)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStateETag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateFileName)
+	s := loadState(path)
+	request := Request{ID: 7, UpdatedAt: "2024-05-01T10:00:00Z"}
+
+	s.update(request, `"v1"`, "")
+	request.UpdatedAt = "2024-05-02T10:00:00Z"
+	s.update(request, "", "") // The details came without an ETag.
+	if err := s.save(0o600); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	record := loadState(path).state.Records["7"]
+	if record.ETag != `"v1"` || record.UpdatedAt != request.UpdatedAt {
+		t.Errorf("record state = %+v, want the ETag kept across the update", record)
+	}
+
+	s.update(request, `"v2"`, "")
+	if got := s.state.Records["7"].ETag; got != `"v2"` {
+		t.Errorf("ETag = %s, want the new one", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// streamMetadata fetches the full details of a request, redacts them, and writes them to
+// standard output as a single line of NDJSON. Lines are written through the
+// console printer, so concurrent workers never interleave them.
+func streamMetadata(ctx context.Context, client *Client, request Request, redact *redactor) (RecordResult, error) {
+	result := RecordResult{ID: request.ID, Title: request.Title, Type: request.Type}
+
+	details, err := client.GetRequestDetails(ctx, request.ID)
+	if err == nil {
+		details, err = redact.request(details)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	_, _ = console.Writer(os.Stdout).Write(append(data, '\n'))
+	result.Complete = true
+	return result, nil
+}
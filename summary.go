@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// Summary aggregates the outcome of a run from its manifest records.
+type Summary struct {
+	Records                   int            `json:"records"`
+	RecordsComplete           int            `json:"records_complete"`
+	RecordsFailed             int            `json:"records_failed"`
+	RecordsWithoutAttachments int            `json:"records_without_attachments"`
+	RecordsUnchanged          int            `json:"records_unchanged"`
+	RecordsTimedOut           int            `json:"records_timed_out"`
+	AttachmentsDownloaded     int            `json:"attachments_downloaded"`
+	AttachmentsExisting       int            `json:"attachments_existing"`
+	AttachmentsReused         int            `json:"attachments_reused"`
+	AttachmentsFailed         int            `json:"attachments_failed"`
+	AttachmentsMissing        int            `json:"attachments_missing"`
+	BytesDownloaded           int64          `json:"bytes_downloaded"`
+	SkippedVersions           int            `json:"skipped_versions"`
+	SkippedOverMax            int            `json:"skipped_over_max"`
+	DocumentsIncluded         int            `json:"documents_included"`
+	DocumentsExcluded         int            `json:"documents_excluded"`
+	NameCollisions            int            `json:"name_collisions"`
+	RecordsByType             map[string]int `json:"records_by_type"`
+	Retries                   int            `json:"retries"`
+	RetryBudgetExhausted      bool           `json:"retry_budget_exhausted"`
+	Issues                    int            `json:"issues"`
+	Errors                    map[string]int `json:"errors"`
+	DurationSeconds           float64        `json:"duration_seconds"`
+	ExitStatus                int            `json:"exit_status"`
+}
+
+// summarize computes the run summary from the records collected so far and the
+// errors counted by category. Records without attachments count as issues when
+// requireAttachments is set.
+func (m *manifestRecorder) summarize(requireAttachments bool, errorCounts *errorCounter) Summary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := Summary{
+		RecordsUnchanged: m.manifest.Unchanged,
+		RecordsByType:    make(map[string]int),
+		Errors:           errorCounts.snapshot(),
+		DurationSeconds:  time.Since(m.started).Round(time.Millisecond).Seconds(),
+	}
+	for _, record := range m.manifest.Records {
+		s.Records++
+		if record.Type != "" {
+			s.RecordsByType[record.Type]++
+		}
+		if record.Error != "" {
+			s.RecordsFailed++
+		} else if record.Complete {
+			s.RecordsComplete++
+		}
+		if record.NoAttachments {
+			s.RecordsWithoutAttachments++
+		}
+		if record.TimedOut {
+			s.RecordsTimedOut++
+		}
+		s.SkippedVersions += record.SkippedVersions
+		s.SkippedOverMax += record.SkippedOverMax
+		s.DocumentsIncluded += record.DocumentsIncluded
+		s.DocumentsExcluded += record.DocumentsExcluded
+		s.NameCollisions += record.NameCollisions
+		for _, attachment := range record.Attachments {
+			switch attachment.Status {
+			case attachmentDownloaded:
+				s.AttachmentsDownloaded++
+				s.BytesDownloaded += attachment.Bytes
+			case attachmentExisting:
+				s.AttachmentsExisting++
+			case attachmentReused:
+				s.AttachmentsReused++
+			case attachmentFailed:
+				s.AttachmentsFailed++
+			case attachmentMissing:
+				s.AttachmentsMissing++
+			}
+		}
+	}
+
+	s.Issues = s.RecordsFailed + s.AttachmentsFailed
+	if requireAttachments {
+		s.Issues += s.RecordsWithoutAttachments
+	}
+	return s
+}
+
+// print writes the summary to the console.
+func (s Summary) print() {
+	console.Printf("Summary: %d records (%d complete, %d failed, %d without attachments)\n",
+		s.Records, s.RecordsComplete, s.RecordsFailed, s.RecordsWithoutAttachments)
+	if s.RecordsUnchanged > 0 {
+		console.Printf("Unchanged: %d records skipped since the last sync\n", s.RecordsUnchanged)
+	}
+	if s.RecordsTimedOut > 0 {
+		console.Printf("Record timeouts: %d records stopped by -max-runtime-per-record\n", s.RecordsTimedOut)
+	}
+	if len(s.RecordsByType) > 0 {
+		console.Printf("Types: %s\n", formatCounts(s.RecordsByType))
+	}
+	console.Printf("Attachments: %d downloaded, %d already present, %d failed, %d older versions skipped\n",
+		s.AttachmentsDownloaded, s.AttachmentsExisting, s.AttachmentsFailed, s.SkippedVersions)
+	if s.SkippedOverMax > 0 {
+		console.Printf("Sampled: %d attachments skipped over the -max-attachments limit\n", s.SkippedOverMax)
+	}
+	if s.AttachmentsMissing > 0 {
+		console.Printf("Missing: %d attachments listed but no longer found remotely\n", s.AttachmentsMissing)
+	}
+	if s.DocumentsIncluded > 0 || s.DocumentsExcluded > 0 {
+		console.Printf("Documents by ID: %d included, %d excluded\n", s.DocumentsIncluded, s.DocumentsExcluded)
+	}
+	if s.AttachmentsReused > 0 {
+		console.Printf("Reused: %d attachments linked or copied from the global index instead of downloaded\n", s.AttachmentsReused)
+	}
+	if s.NameCollisions > 0 {
+		console.Printf("Name collisions: %d attachments renamed to stay unique\n", s.NameCollisions)
+	}
+	if s.RetryBudgetExhausted {
+		console.Printf("Retries: %d (retry budget exhausted; later failures were not retried)\n", s.Retries)
+	} else if s.Retries > 0 {
+		console.Printf("Retries: %d\n", s.Retries)
+	}
+	console.Printf("Issues: %d\n", s.Issues)
+	if len(s.Errors) > 0 {
+		console.Printf("Errors: %s\n", formatCounts(s.Errors))
+	}
+}
+
+// errorRate returns the share of the records that failed, from 0 to 1.
+func (s Summary) errorRate() float64 {
+	if s.Records == 0 {
+		return 0
+	}
+	return float64(s.RecordsFailed) / float64(s.Records)
+}
+
+// checkErrorRate sets the exit status to exitErrorRate when the share of failed
+// records is above maxRate, unless the run already failed for another reason.
+func (s *Summary) checkErrorRate(maxRate float64) {
+	if rate := s.errorRate(); rate > maxRate && s.ExitStatus == 0 {
+		log.Printf("Error: %d of %d records failed (%.1f%%), above the -max-error-rate of %.1f%%", s.RecordsFailed, s.Records, rate*100, maxRate*100)
+		s.ExitStatus = exitErrorRate
+	}
+}
+
+// write saves the summary as JSON to path, for schedulers that ingest run results.
+func (s Summary) write(path string, mode os.FileMode) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, mode)
+}
+
+// merge adds the counts of another run to the summary.
+func (s *Summary) merge(o Summary) {
+	s.Records += o.Records
+	s.RecordsComplete += o.RecordsComplete
+	s.RecordsFailed += o.RecordsFailed
+	s.RecordsWithoutAttachments += o.RecordsWithoutAttachments
+	s.RecordsUnchanged += o.RecordsUnchanged
+	s.RecordsTimedOut += o.RecordsTimedOut
+	s.AttachmentsDownloaded += o.AttachmentsDownloaded
+	s.AttachmentsExisting += o.AttachmentsExisting
+	s.AttachmentsReused += o.AttachmentsReused
+	s.AttachmentsFailed += o.AttachmentsFailed
+	s.AttachmentsMissing += o.AttachmentsMissing
+	s.BytesDownloaded += o.BytesDownloaded
+	s.SkippedVersions += o.SkippedVersions
+	s.SkippedOverMax += o.SkippedOverMax
+	s.DocumentsIncluded += o.DocumentsIncluded
+	s.DocumentsExcluded += o.DocumentsExcluded
+	s.NameCollisions += o.NameCollisions
+	s.Retries += o.Retries
+	s.RetryBudgetExhausted = s.RetryBudgetExhausted || o.RetryBudgetExhausted
+	s.Issues += o.Issues
+	s.RecordsByType = mergeCounts(s.RecordsByType, o.RecordsByType)
+	s.Errors = mergeCounts(s.Errors, o.Errors)
+	s.ExitStatus = max(s.ExitStatus, o.ExitStatus)
+}
+
+// mergeCounts adds the counts of b to a, allocating a if needed.
+func mergeCounts(a, b map[string]int) map[string]int {
+	if a == nil {
+		a = make(map[string]int, len(b))
+	}
+	for key, n := range b {
+		a[key] += n
+	}
+	return a
+}
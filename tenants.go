@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Tenant is one ZenGRC instance exported by -all-tenants.
+type Tenant struct {
+	Name      string `json:"name"`
+	APIURL    string `json:"api_url"`
+	Token     string `json:"token"`
+	OutputDir string `json:"output_dir"`
+}
+
+// tenantsConfig is the file read by -tenants-config.
+type tenantsConfig struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// loadTenants reads the tenants config file. Every tenant needs a unique name,
+// an API URL, and a token; its output directory, which may contain the same
+// variables as -output-dir, defaults to <baseOutputDir>/<name>.
+func loadTenants(path, baseOutputDir string, now time.Time) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config tenantsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(config.Tenants) == 0 {
+		return nil, fmt.Errorf("%s: no tenants configured", path)
+	}
+
+	names := make(map[string]bool, len(config.Tenants))
+	for i := range config.Tenants {
+		tenant := &config.Tenants[i]
+		switch {
+		case tenant.Name == "":
+			return nil, fmt.Errorf("%s: tenant %d has no name", path, i+1)
+		case names[tenant.Name]:
+			return nil, fmt.Errorf("%s: duplicate tenant %q", path, tenant.Name)
+		case tenant.APIURL == "" || tenant.Token == "":
+			return nil, fmt.Errorf("%s: tenant %q needs an api_url and a token", path, tenant.Name)
+		}
+		if err := checkToken(tenant.Token); err != nil {
+			return nil, fmt.Errorf("%s: tenant %q: %w", path, tenant.Name, err)
+		}
+		warning, err := checkAPIURL(tenant.APIURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tenant %q: %w", path, tenant.Name, err)
+		}
+		if warning != "" {
+			log.Printf("Warning: tenant %s: %s", tenant.Name, warning)
+		}
+		names[tenant.Name] = true
+
+		if tenant.OutputDir == "" {
+			tenant.OutputDir = filepath.Join(baseOutputDir, tenant.Name)
+		} else if tenant.OutputDir, err = expandPath(tenant.OutputDir, now); err != nil {
+			return nil, fmt.Errorf("%s: tenant %q: %w", path, tenant.Name, err)
+		}
+	}
+	return config.Tenants, nil
+}
+
+// forTenant returns a copy of the options for a tenant's run, writing to its
+// own output directory with its own reports and, for incremental syncs, its own
+// state file.
+func (o *options) forTenant(tenant Tenant, incremental bool) *options {
+	tenantOpts := *o
+	tenantOpts.outputDir = tenant.OutputDir
+	tenantOpts.metadataDir, tenantOpts.attachmentsDir = tenant.OutputDir, tenant.OutputDir
+	tenantOpts.people = newPeopleIndex()
+	tenantOpts.reviews = newReviewReport()
+	tenantOpts.errors = newErrorCounter()
+	tenantOpts.flatNames = newNameRegistry()
+	tenantOpts.state = nil
+	if o.checksums != nil {
+		tenantOpts.checksums = loadChecksums(filepath.Join(tenant.OutputDir, manifestFileName))
+	}
+	if incremental || o.onlyNewAttachments {
+		tenantOpts.state = loadState(filepath.Join(tenant.OutputDir, stateFileName))
+	}
+	return &tenantOpts
+}
+
+// runTenants exports every tenant with its own client, running up to
+// concurrency tenants at a time, and returns the combined summary of all runs.
+// A tenant whose requests could not be listed is reported and fails the run.
+func runTenants(ctx context.Context, tenants []Tenant, opts *options, clientOpts []Option, concurrency int, incremental bool) Summary {
+	started := time.Now()
+	summaries := make([]Summary, len(tenants))
+	listErrs := make([]error, len(tenants))
+	slots := make(chan struct{}, max(1, concurrency))
+	var wg sync.WaitGroup
+	for i, tenant := range tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			console.Printf("Tenant %s: exporting %s to %s\n", tenant.Name, tenant.APIURL, tenant.OutputDir)
+			client := NewClient(tenant.APIURL, tenant.Token, clientOpts...)
+			summaries[i], listErrs[i] = runPass(ctx, client, opts.forTenant(tenant, incremental))
+		}()
+	}
+	wg.Wait()
+
+	var combined Summary
+	for i, summary := range summaries {
+		console.Printf("Tenant %s: %d records, %d issues\n", tenants[i].Name, summary.Records, summary.Issues)
+		if listErrs[i] != nil {
+			log.Printf("Error: tenant %s: failed to get requests: %v", tenants[i].Name, listErrs[i])
+		}
+		combined.merge(summary)
+	}
+	combined.DurationSeconds = time.Since(started).Round(time.Millisecond).Seconds()
+	return combined
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// WithTracing logs the DNS lookup, connect, TLS handshake, and time-to-first-byte
+// durations of every request, to help diagnose slow environments.
+func WithTracing() Option {
+	return func(c *Client) {
+		c.trace = true
+	}
+}
+
+// withTrace returns req with an httptrace.ClientTrace attached that logs the
+// latency of each phase of the request once its first response byte arrives.
+func withTrace(req *http.Request) *http.Request {
+	var start, dnsStart, connectStart, tlsStart time.Time
+	var dns, connect, handshake time.Duration
+	reused := false
+
+	trace := &httptrace.ClientTrace{
+		GetConn:      func(string) { start = time.Now() },
+		GotConn:      func(info httptrace.GotConnInfo) { reused = info.Reused },
+		DNSStart:     func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:      func(httptrace.DNSDoneInfo) { dns = time.Since(dnsStart) },
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone:  func(string, string, error) { connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			handshake = time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			log.Printf("trace %s %s: dns=%s connect=%s tls=%s ttfb=%s reused=%t",
+				req.Method, req.URL.Path, dns, connect, handshake, time.Since(start), reused)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
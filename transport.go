@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Middleware wraps the transport of the client's HTTP client, for example to
+// record metrics or to log requests.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// WithMiddleware adds middleware around the transport of the client's HTTP
+// client. The middleware sees every request as sent on the wire, with its
+// credentials and default headers, including retries and redirects. The first
+// middleware given is the outermost.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// apiTransport sets the default headers of every request and the credentials
+// of requests to the API itself. Requests to any other scheme or host, such as
+// a signed storage URL an attachment download is redirected to, are sent
+// without credentials: the token never leaves the API host, not even for one
+// of its subdomains.
+type apiTransport struct {
+	client *Client
+	origin *url.URL
+	base   http.RoundTripper
+}
+
+// wrapTransport returns a copy of httpClient whose transport, wrapped in the
+// client's middleware, goes through an apiTransport.
+func (c *Client) wrapTransport(httpClient *http.Client) *http.Client {
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		base = c.middleware[i](base)
+	}
+	origin, _ := url.Parse(c.apiURL)
+
+	wrapped := *httpClient
+	wrapped.Transport = &apiTransport{client: c, origin: origin, base: base}
+	return &wrapped
+}
+
+// RoundTrip implements http.RoundTripper. When an API request is rejected with
+// 401 while a token provider is configured, the token is refreshed and the
+// request is sent once more.
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", t.client.userAgent)
+	if t.client.trace {
+		req = withTrace(req)
+	}
+	if t.origin == nil || req.URL.Scheme != t.origin.Scheme || req.URL.Host != t.origin.Host {
+		return t.base.RoundTrip(req)
+	}
+
+	auth, err := t.client.authorization(req.Context())
+	if err != nil {
+		return nil, &authError{err: err}
+	}
+	req.Header.Set("Authorization", auth)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.client.tokenProvider == nil {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil // The body cannot be sent again.
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if err := t.client.refreshAuthorization(req); err != nil {
+		return nil, &authError{err: err}
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// authError is a failure to obtain credentials for a request. It is not retried.
+type authError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e *authError) Error() string { return e.err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *authError) Unwrap() error { return e.err }
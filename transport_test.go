@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedirectStripsCredentials(t *testing.T) {
+	var mu sync.Mutex
+	auth := make(map[string]string) // Authorization header by path.
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth[r.Host+r.URL.Path] = r.Header.Get("Authorization")
+	}
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = io.WriteString(w, "signed content")
+	}))
+	defer storage.Close()
+
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/files/1"):
+			http.Redirect(w, r, storage.URL+"/bucket/report.pdf?signature=abc", http.StatusFound)
+		case strings.HasSuffix(r.URL.Path, "/files/2"):
+			http.Redirect(w, r, api.URL+"/mirror/notes.txt", http.StatusFound)
+		default:
+			_, _ = io.WriteString(w, "api content")
+		}
+	}))
+	defer api.Close()
+
+	client := NewClient(api.URL, "key:secret")
+	dir := t.TempDir()
+	ctx := context.Background()
+	for _, attachment := range []File{{DocumentID: 1, Name: "report.pdf"}, {DocumentID: 2, Name: "notes.txt"}} {
+		if err := client.DownloadAttachment(ctx, 7, attachment, dir, false); err != nil {
+			t.Fatalf("DownloadAttachment(%s): %v", attachment.Name, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "report.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "signed content" {
+		t.Errorf("report.pdf = %q, want the content of the signed URL", data)
+	}
+
+	apiHost, storageHost := strings.TrimPrefix(api.URL, "http://"), strings.TrimPrefix(storage.URL, "http://")
+	want := basicAuth("key:secret")
+	mu.Lock()
+	defer mu.Unlock()
+	if got := auth[apiHost+"/api/v2/requests/7/files/1"]; got != want {
+		t.Errorf("API request sent Authorization %q, want %q", got, want)
+	}
+	if got, ok := auth[storageHost+"/bucket/report.pdf"]; !ok || got != "" {
+		t.Errorf("redirect to another host sent Authorization %q (requested %t), want none", got, ok)
+	}
+	if got := auth[apiHost+"/mirror/notes.txt"]; got != want {
+		t.Errorf("redirect within the API host sent Authorization %q, want %q", got, want)
+	}
+}
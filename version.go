@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build metadata, overridable at build time with
+// -ldflags "-X main.commit=<sha> -X main.buildDate=<date>". When left empty, they
+// are filled from the VCS information recorded in the build info, if any.
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+// buildCommit returns the commit the binary was built from, or "unknown".
+func buildCommit() string {
+	return buildSetting(commit, "vcs.revision")
+}
+
+// buildTime returns the date the binary was built, or "unknown". Without an
+// explicit build date, the time of the commit is used.
+func buildTime() string {
+	return buildSetting(buildDate, "vcs.time")
+}
+
+// buildSetting returns value if set, or else the named build info setting.
+func buildSetting(value, key string) string {
+	if value != "" {
+		return value
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == key && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// versionString describes the build for -version.
+func versionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", appVersion(), buildCommit(), buildTime())
+}
+
+// appVersion returns the version set at build time with -X main.version=, or,
+// for a dev build, the module version recorded in the build info if there is one.
+func appVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// defaultUserAgent is the User-Agent sent with every request unless overridden.
+func defaultUserAgent() string {
+	return "zengrc-downloader/" + appVersion()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Webhook settings: the signature header, and the timeout and retries of each
+// delivery.
+const (
+	webhookSignatureHeader = "X-Zengrc-Signature"
+	webhookEventHeader     = "X-Zengrc-Event"
+	webhookTimeout         = 10 * time.Second
+	webhookRetries         = 2
+	webhookBaseDelay       = 2 * time.Second
+)
+
+// Events of the run webhook: a run, or a -follow pass, that ended with a zero
+// exit status, and one that did not.
+const (
+	webhookRunCompleted = "run.completed"
+	webhookRunFailed    = "run.failed"
+)
+
+// WebhookPayload is the JSON document posted to -webhook-url at the end of a run.
+type WebhookPayload struct {
+	Event   string  `json:"event"`
+	SentAt  string  `json:"sent_at"`
+	Version string  `json:"version"`
+	Summary Summary `json:"summary"`
+}
+
+// webhook posts the run summary to a URL, as a WebhookPayload signed with an
+// HMAC-SHA256 of the body keyed by a shared secret, if any, or formatted as a
+// chat message by -notify. Its client is separate from the API client, so that
+// the API credentials are never sent to it.
+type webhook struct {
+	name    string
+	url     string
+	secret  string
+	payload func(event string, summary Summary) ([]byte, error)
+	client  *http.Client
+}
+
+// newWebhook creates a webhook posting a WebhookPayload to target.
+func newWebhook(target, secret string) *webhook {
+	return &webhook{
+		name:    "webhook",
+		url:     target,
+		secret:  secret,
+		payload: webhookPayload,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// webhookPayload encodes the WebhookPayload of an event.
+func webhookPayload(event string, summary Summary) ([]byte, error) {
+	return json.Marshal(WebhookPayload{
+		Event:   event,
+		SentAt:  time.Now().UTC().Format(time.RFC3339),
+		Version: appVersion(),
+		Summary: summary,
+	})
+}
+
+// sign returns the signature header value of a body: "sha256=" and the hex
+// HMAC-SHA256 of the body keyed by the secret, which the receiver computes
+// again to verify that the payload comes from this run.
+func (w *webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify posts the summary of a run, retrying with backoff up to webhookRetries
+// times while the delivery fails. A webhook that cannot be delivered is logged
+// but does not change the outcome of the run.
+func (w *webhook) notify(ctx context.Context, summary Summary) {
+	event := webhookRunCompleted
+	if summary.ExitStatus != 0 {
+		event = webhookRunFailed
+	}
+	body, err := w.payload(event, summary)
+	if err != nil {
+		log.Printf("Error encoding %s payload: %v", w.name, err)
+		return
+	}
+
+	// The run context may be done already, as after a deadline; the delivery
+	// is bounded by its own timeouts instead.
+	ctx = context.WithoutCancel(ctx)
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, event, body)
+		if err == nil {
+			return
+		}
+		if attempt >= webhookRetries {
+			log.Printf("Error sending %s after %d attempts: %v", w.name, attempt+1, err)
+			return
+		}
+		delay := backoff(webhookBaseDelay, attempt)
+		log.Printf("Sending %s failed, retrying in %s (%d/%d): %v", w.name, delay.Round(time.Millisecond), attempt+1, webhookRetries, err)
+		if err := sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+}
+
+// post makes one delivery attempt, which succeeds on a 2xx response.
+func (w *webhook) post(ctx context.Context, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent())
+	req.Header.Set(webhookEventHeader, event)
+	if w.secret != "" {
+		req.Header.Set(webhookSignatureHeader, w.sign(body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // The URL may hold a secret, as chat webhooks do.
+		}
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %s", w.name, resp.Status)
+	}
+	return nil
+}